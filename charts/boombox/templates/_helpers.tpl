@@ -1,3 +1,13 @@
+{{/*
+Fail on values that can't work together.
+*/}}
+{{- define "boombox.validateValues" -}}
+{{- $replicas := ternary (int .Values.autoscaling.maxReplicas) (int .Values.replicaCount) .Values.autoscaling.enabled }}
+{{- if and .Values.config.previewURL (not .Values.secrets.previewSecret) (gt $replicas 1) }}
+{{- fail "secrets.previewSecret is required with config.previewURL and more than one replica, otherwise the preview logins only work in the replica that created them" }}
+{{- end }}
+{{- end }}
+
 {{/*
 Expand the name of the chart.
 */}}
@@ -71,3 +81,14 @@ Extract the port from the listen configuration property
 {{- "2828" }}
 {{- end }}
 {{- end }}
+
+{{/*
+Extract the port from the previewListen configuration property
+*/}}
+{{- define "boombox.previewContainerPort" -}}
+{{- if .Values.config.previewListen }}
+{{- .Values.config.previewListen | split ":" | last }}
+{{- else }}
+{{- "8080" }}
+{{- end }}
+{{- end }}
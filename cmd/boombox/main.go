@@ -2,24 +2,66 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/ivanvc/boombox/internal/auth"
 	"github.com/ivanvc/boombox/internal/config"
+	"github.com/ivanvc/boombox/internal/recording"
 	"github.com/ivanvc/boombox/internal/server"
 	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+	"github.com/ivanvc/boombox/internal/services/local"
 
 	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
 )
 
 func main() {
 	cfg := config.Load()
 	log.SetLevel(log.ParseLevel(cfg.LogLevel))
-	client := k8s.LoadClient(cfg.Namespace)
+	backend, client := loadBackend(cfg)
 
-	s := server.New(cfg, client)
+	usersCtx, stopUsers := context.WithCancel(context.Background())
+	defer stopUsers()
+	var users *k8s.UserRegistry
+	if cfg.UserRegistry {
+		if client == nil {
+			log.Fatal("Error initializing user registry", "error", fmt.Errorf("the user registry needs the kubernetes backend"))
+		}
+		var err error
+		if users, err = client.NewUserRegistry(); err != nil {
+			log.Fatal("Error initializing user registry", "error", err)
+		}
+		if err := users.Start(usersCtx); err != nil {
+			log.Fatal("Error starting user registry", "error", err)
+		}
+	}
+
+	authenticator, err := auth.Load(cfg, client, users)
+	if err != nil {
+		log.Fatal("Error loading authenticator", "error", err)
+	}
+
+	if err := recording.ValidateMode(cfg.Recording); err != nil {
+		log.Fatal("Error loading recording mode", "error", err)
+	}
+
+	s := server.New(cfg, backend, authenticator, users)
+
+	var previews *http.Server
+	if h := s.Previews(); h != nil {
+		previews = &http.Server{Addr: cfg.PreviewListen, Handler: h}
+		log.Infof("Starting preview proxy on %s", cfg.PreviewListen)
+		go func() {
+			if err := previews.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal("Error serving previews", "error", err)
+			}
+		}()
+	}
 
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
@@ -34,13 +76,37 @@ func main() {
 
 	<-done
 	log.Info("Stopping SSH server")
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Give time to release the Pods after the grace period.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownGracePeriod+30*time.Second)
 	defer func() { cancel() }()
 	if err := s.Shutdown(ctx); err != nil {
 		log.Fatal(err)
 	}
+	if previews != nil {
+		previews.Shutdown(ctx)
+	}
 
-	if err := <-listenChan; err != nil {
+	if err := <-listenChan; err != nil && err != ssh.ErrServerClosed {
 		log.Fatal(err)
 	}
 }
+
+// Returns the backend that runs the boxes, and the Kubernetes client the
+// authentication and the user registry use, which is nil with the local
+// backend.
+func loadBackend(cfg *config.Config) (k8s.Backend, *k8s.Client) {
+	switch cfg.Backend {
+	case "kubernetes":
+		client := k8s.LoadClient(cfg.Namespace)
+		return client, client
+	case "local":
+		b, err := local.New(cfg.LocalHomePath, cfg.Namespace)
+		if err != nil {
+			log.Fatal("Error initializing local backend", "error", err)
+		}
+		log.Warn("Running the boxes as local processes, they are not isolated", "homes", cfg.LocalHomePath)
+		return b, nil
+	}
+	log.Fatal("Error loading backend", "error", fmt.Errorf("unknown backend %q", cfg.Backend))
+	return nil, nil
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/ivanvc/boombox/internal/config"
+	"github.com/ivanvc/boombox/internal/identity"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// Authentication modes supported by Load.
+const (
+	ModeNone           = "none"
+	ModeAuthorizedKeys = "authorized-keys"
+	ModeKubernetes     = "kubernetes"
+	ModeUserRegistry   = "user-registry"
+)
+
+// Authenticator decides if a public key is allowed to log in as the user in
+// the SSH context.
+type Authenticator interface {
+	Authenticate(ctx ssh.Context, key ssh.PublicKey) bool
+}
+
+// Load returns the Authenticator for the configured authentication mode. If
+// there are trusted user CA keys, certificates are checked against them, and
+// plain keys are handled by the authentication mode. If the user registry is
+// enabled (users is not nil), only users with an enabled BoomboxUser are
+// allowed, and their keys are checked against the BoomboxUser if there's no
+// authentication mode. It returns a nil Authenticator when authentication is
+// disabled.
+func Load(cfg *config.Config, client *k8s.Client, users *k8s.UserRegistry) (Authenticator, error) {
+	authenticator, err := loadMode(cfg, client, users)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TrustedUserCAKeysPath != "" {
+		authenticator, err = NewCertificateAuthority(cfg.TrustedUserCAKeysPath, authenticator)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if users != nil {
+		// Otherwise, any key could log in as any registered user.
+		if authenticator == nil {
+			authenticator = NewUserRegistryKeys(users)
+		}
+		return NewUserGate(users, authenticator), nil
+	}
+	if authenticator == nil {
+		log.Warn("Authentication is disabled, any user will be able to log in")
+		return nil, nil
+	}
+	return authenticator, nil
+}
+
+func loadMode(cfg *config.Config, client *k8s.Client, users *k8s.UserRegistry) (Authenticator, error) {
+	switch cfg.AuthMode {
+	case ModeNone, "":
+		return nil, nil
+	case ModeAuthorizedKeys:
+		return NewKeysDirectory(cfg.AuthorizedKeysPath), nil
+	case ModeKubernetes:
+		if client == nil {
+			return nil, fmt.Errorf("authentication mode %q requires the kubernetes backend", cfg.AuthMode)
+		}
+		return NewKubernetesKeys(client, cfg.AuthorizedKeysPrefix), nil
+	case ModeUserRegistry:
+		if users == nil {
+			return nil, fmt.Errorf("authentication mode %q requires the user registry", cfg.AuthMode)
+		}
+		return NewUserRegistryKeys(users), nil
+	}
+	return nil, fmt.Errorf("unknown authentication mode %q", cfg.AuthMode)
+}
+
+// Parses an authorized_keys formatted document, skipping invalid lines.
+func parseAuthorizedKeys(data []byte) []ssh.PublicKey {
+	keys := make([]ssh.PublicKey, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, _, _, _, err := gossh.ParseAuthorizedKey(line)
+		if err != nil {
+			log.Debug("Skipping invalid authorized key", "error", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Returns true if key is in the keys list.
+func containsKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, k := range keys {
+		if ssh.KeysEqual(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the username of the login, without the selector.
+func username(ctx ssh.Context) string {
+	return identity.Username(ctx.User())
+}
+
+// Logs a rejected login attempt.
+func reject(ctx ssh.Context, key ssh.PublicKey, reason string) bool {
+	log.Warn("Rejected public key",
+		"user", ctx.User(),
+		"remote-addr", ctx.RemoteAddr(),
+		"fingerprint", gossh.FingerprintSHA256(key),
+		"reason", reason,
+	)
+	return false
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/ivanvc/boombox/internal/config"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// testContext is the SSH context of a login attempt.
+type testContext struct {
+	context.Context
+	sync.Mutex
+	user   string
+	addr   net.Addr
+	values map[any]any
+}
+
+func newContext(user, ip string) *testContext {
+	return &testContext{
+		Context: context.Background(),
+		user:    user,
+		addr:    &net.TCPAddr{IP: net.ParseIP(ip), Port: 50000},
+		values:  make(map[any]any),
+	}
+}
+
+func (c *testContext) User() string          { return c.user }
+func (c *testContext) SessionID() string     { return "session" }
+func (c *testContext) ClientVersion() string { return "SSH-2.0-test" }
+func (c *testContext) ServerVersion() string { return "SSH-2.0-boombox" }
+func (c *testContext) RemoteAddr() net.Addr  { return c.addr }
+func (c *testContext) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 2828}
+}
+func (c *testContext) Permissions() *ssh.Permissions {
+	return &ssh.Permissions{Permissions: &gossh.Permissions{}}
+}
+func (c *testContext) SetValue(key, value any) { c.values[key] = value }
+
+func (c *testContext) Value(key any) any {
+	if v, ok := c.values[key]; ok {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+// Returns a new ed25519 key, and its signer.
+func newKey(t *testing.T) (ssh.PublicKey, gossh.Signer) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer.PublicKey(), signer
+}
+
+// Returns the keys in the authorized_keys format.
+func authorizedKeys(keys ...ssh.PublicKey) string {
+	var b strings.Builder
+	for _, key := range keys {
+		b.Write(gossh.MarshalAuthorizedKey(key))
+	}
+	return b.String()
+}
+
+func TestKeysDirectory(t *testing.T) {
+	alice, _ := newKey(t)
+	revoked, _ := newKey(t)
+	stranger, _ := newKey(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "alice")
+	if err := os.WriteFile(path, []byte("# alice's keys\n"+authorizedKeys(alice, revoked)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kd := NewKeysDirectory(dir)
+
+	tests := []struct {
+		name string
+		user string
+		key  ssh.PublicKey
+		want bool
+	}{
+		{"authorized key", "alice", alice, true},
+		{"authorized key with a selector", "alice+resume", alice, true},
+		{"unknown key", "alice", stranger, false},
+		{"user without keys", "bob", alice, false},
+		{"path traversal", "../alice", alice, false},
+		{"hidden file", ".alice", alice, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kd.Authenticate(newContext(tt.user, "192.0.2.1"), tt.key); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("revoked key", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte(authorizedKeys(alice)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		// The file is reloaded when its modification time changes.
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+		if kd.Authenticate(newContext("alice", "192.0.2.1"), revoked) {
+			t.Error("got the revoked key accepted")
+		}
+		if !kd.Authenticate(newContext("alice", "192.0.2.1"), alice) {
+			t.Error("got the authorized key rejected")
+		}
+	})
+
+	t.Run("removed file", func(t *testing.T) {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+		if kd.Authenticate(newContext("alice", "192.0.2.1"), alice) {
+			t.Error("got the key accepted after removing the file")
+		}
+	})
+}
+
+func TestKubernetesKeys(t *testing.T) {
+	alice, _ := newKey(t)
+	bob, _ := newKey(t)
+	stranger, _ := newKey(t)
+	objects := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "keys-alice", Namespace: "boombox"},
+			Data:       map[string][]byte{authorizedKeysDataKey: []byte(authorizedKeys(alice))},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "keys-bob", Namespace: "boombox"},
+			Data:       map[string]string{authorizedKeysDataKey: authorizedKeys(bob)},
+		},
+		// The Secret takes precedence over the ConfigMap.
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "keys-alice", Namespace: "boombox"},
+			Data:       map[string]string{authorizedKeysDataKey: authorizedKeys(stranger)},
+		},
+	}
+	kk := NewKubernetesKeys(k8s.NewClient(k8sfake.NewSimpleClientset(objects...), nil, nil, "boombox"), "keys-")
+
+	tests := []struct {
+		name string
+		user string
+		key  ssh.PublicKey
+		want bool
+	}{
+		{"key in the Secret", "alice", alice, true},
+		{"key in the ConfigMap", "bob", bob, true},
+		{"key only in the shadowed ConfigMap", "alice", stranger, false},
+		{"another user's key", "bob", alice, false},
+		{"user without keys", "carol", alice, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kk.Authenticate(newContext(tt.user, "192.0.2.1"), tt.key); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadChecksRegistryKeysWithoutMode(t *testing.T) {
+	users := &k8s.UserRegistry{}
+	authenticator, err := Load(&config.Config{AuthMode: ModeNone}, nil, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate, ok := authenticator.(*UserGate)
+	if !ok {
+		t.Fatalf("got authenticator %T, want the user gate", authenticator)
+	}
+	if _, ok := gate.next.(*UserRegistryKeys); !ok {
+		t.Errorf("got next authenticator %T, want the BoomboxUser keys", gate.next)
+	}
+}
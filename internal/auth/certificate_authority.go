@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ExtensionImage is the certificate extension that overrides the container
+// image for the user's Pod.
+const ExtensionImage = "boombox-image"
+
+const sourceAddressCriticalOption = "source-address"
+
+type contextKey struct{ name string }
+
+var contextKeyCertificate = &contextKey{"certificate"}
+
+// CertificateAuthority authenticates users presenting an OpenSSH user
+// certificate signed by one of the trusted CA keys, and that lists the user as
+// a principal. Plain public keys are delegated to the fallback Authenticator,
+// or rejected if there's none.
+type CertificateAuthority struct {
+	authorities []ssh.PublicKey
+	fallback    Authenticator
+	checker     *gossh.CertChecker
+}
+
+// NewCertificateAuthority returns a new CertificateAuthority trusting the CA
+// keys from the authorized_keys formatted file at path.
+func NewCertificateAuthority(path string, fallback Authenticator) (*CertificateAuthority, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	authorities := parseAuthorizedKeys(data)
+	if len(authorities) == 0 {
+		return nil, fmt.Errorf("no CA keys found in %q", path)
+	}
+
+	return &CertificateAuthority{
+		authorities: authorities,
+		fallback:    fallback,
+		checker: &gossh.CertChecker{
+			SupportedCriticalOptions: []string{sourceAddressCriticalOption},
+		},
+	}, nil
+}
+
+// Authenticate implements Authenticator.
+func (ca *CertificateAuthority) Authenticate(ctx ssh.Context, key ssh.PublicKey) bool {
+	ctx.SetValue(contextKeyCertificate, nil)
+
+	cert, ok := key.(*gossh.Certificate)
+	if !ok {
+		if ca.fallback == nil {
+			return reject(ctx, key, "only certificates are allowed")
+		}
+		return ca.fallback.Authenticate(ctx, key)
+	}
+
+	if cert.CertType != gossh.UserCert {
+		return reject(ctx, key, "not a user certificate")
+	}
+	if !containsKey(ca.authorities, cert.SignatureKey) {
+		return reject(ctx, key, "certificate not signed by a trusted authority")
+	}
+	if len(cert.ValidPrincipals) == 0 {
+		return reject(ctx, key, "certificate has no principals")
+	}
+	if err := ca.checker.CheckCert(username(ctx), cert); err != nil {
+		return reject(ctx, key, err.Error())
+	}
+	if err := checkSourceAddress(ctx.RemoteAddr(), cert.CriticalOptions[sourceAddressCriticalOption]); err != nil {
+		return reject(ctx, key, err.Error())
+	}
+
+	ctx.SetValue(contextKeyCertificate, cert)
+	return true
+}
+
+// Extensions returns the certificate extensions of the authenticated user, or
+// nil if the user didn't log in with a certificate. The client can offer
+// several keys before authenticating with one, so the extensions are only
+// returned if the certificate checked last is the key the connection
+// authenticated with.
+func Extensions(ctx context.Context) map[string]string {
+	cert, ok := ctx.Value(contextKeyCertificate).(*gossh.Certificate)
+	if !ok {
+		return nil
+	}
+	key, ok := ctx.Value(ssh.ContextKeyPublicKey).(ssh.PublicKey)
+	if !ok || !ssh.KeysEqual(cert, key) {
+		return nil
+	}
+	return cert.Extensions
+}
+
+// Checks the remote address against the comma separated list of addresses or
+// CIDRs from the source-address critical option.
+func checkSourceAddress(addr net.Addr, sourceAddress string) error {
+	if sourceAddress == "" {
+		return nil
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return fmt.Errorf("source-address: remote address %q is not a TCP address", addr)
+	}
+
+	for _, source := range strings.Split(sourceAddress, ",") {
+		if ip := net.ParseIP(source); ip != nil {
+			if ip.Equal(tcpAddr.IP) {
+				return nil
+			}
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(source)
+		if err != nil {
+			return fmt.Errorf("source-address: invalid address %q", source)
+		}
+		if ipNet.Contains(tcpAddr.IP) {
+			return nil
+		}
+	}
+	return fmt.Errorf("source-address: %q is not allowed", tcpAddr.IP)
+}
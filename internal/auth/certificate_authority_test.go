@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// acceptAll is a fallback Authenticator that accepts every key.
+type acceptAll struct{}
+
+func (acceptAll) Authenticate(ssh.Context, ssh.PublicKey) bool { return true }
+
+func TestCertificateAuthority(t *testing.T) {
+	_, caSigner := newKey(t)
+	_, untrustedSigner := newKey(t)
+	userKey, _ := newKey(t)
+	path := filepath.Join(t.TempDir(), "ca.pub")
+	if err := os.WriteFile(path, []byte(authorizedKeys(caSigner.PublicKey())), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Returns a certificate for userKey, valid for alice, after modify
+	// changes it, signed by signer.
+	sign := func(signer gossh.Signer, modify func(*gossh.Certificate)) ssh.PublicKey {
+		cert := &gossh.Certificate{
+			Key:             userKey,
+			CertType:        gossh.UserCert,
+			ValidPrincipals: []string{"alice"},
+			ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+			ValidBefore:     uint64(time.Now().Add(time.Hour).Unix()),
+			Permissions: gossh.Permissions{
+				CriticalOptions: map[string]string{},
+				Extensions:      map[string]string{ExtensionImage: "ubuntu:22.04"},
+			},
+		}
+		if modify != nil {
+			modify(cert)
+		}
+		if err := cert.SignCert(rand.Reader, signer); err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		ip       string
+		key      ssh.PublicKey
+		fallback Authenticator
+		want     bool
+	}{
+		{"valid certificate", "alice", "192.0.2.1", sign(caSigner, nil), nil, true},
+		{"valid certificate with a selector", "alice+resume", "192.0.2.1", sign(caSigner, nil), nil, true},
+		{"expired certificate", "alice", "192.0.2.1", sign(caSigner, func(c *gossh.Certificate) {
+			c.ValidBefore = uint64(time.Now().Add(-time.Minute).Unix())
+		}), nil, false},
+		{"certificate not yet valid", "alice", "192.0.2.1", sign(caSigner, func(c *gossh.Certificate) {
+			c.ValidAfter = uint64(time.Now().Add(time.Minute).Unix())
+		}), nil, false},
+		{"wrong principal", "bob", "192.0.2.1", sign(caSigner, nil), nil, false},
+		{"no principals", "alice", "192.0.2.1", sign(caSigner, func(c *gossh.Certificate) {
+			c.ValidPrincipals = nil
+		}), nil, false},
+		{"host certificate", "alice", "192.0.2.1", sign(caSigner, func(c *gossh.Certificate) {
+			c.CertType = gossh.HostCert
+		}), nil, false},
+		{"untrusted authority", "alice", "192.0.2.1", sign(untrustedSigner, nil), nil, false},
+		{"allowed source address", "alice", "192.0.2.1", sign(caSigner, func(c *gossh.Certificate) {
+			c.CriticalOptions[sourceAddressCriticalOption] = "198.51.100.7,192.0.2.0/24"
+		}), nil, true},
+		{"denied source address", "alice", "203.0.113.9", sign(caSigner, func(c *gossh.Certificate) {
+			c.CriticalOptions[sourceAddressCriticalOption] = "198.51.100.7,192.0.2.0/24"
+		}), nil, false},
+		{"unknown critical option", "alice", "192.0.2.1", sign(caSigner, func(c *gossh.Certificate) {
+			c.CriticalOptions["force-command"] = "/bin/true"
+		}), nil, false},
+		{"plain key without a fallback", "alice", "192.0.2.1", userKey, nil, false},
+		{"plain key with a fallback", "alice", "192.0.2.1", userKey, acceptAll{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca, err := NewCertificateAuthority(path, tt.fallback)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := newContext(tt.user, tt.ip)
+			if got := ca.Authenticate(ctx, tt.key); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if tt.want {
+				// Like the server, once the key is accepted.
+				ctx.SetValue(ssh.ContextKeyPublicKey, tt.key)
+			}
+
+			_, isCert := tt.key.(*gossh.Certificate)
+			wantImage := ""
+			if tt.want && isCert {
+				wantImage = "ubuntu:22.04"
+			}
+			if got := Extensions(ctx)[ExtensionImage]; got != wantImage {
+				t.Errorf("got image extension %q, want %q", got, wantImage)
+			}
+		})
+	}
+}
+
+func TestExtensionsOfAnotherKey(t *testing.T) {
+	_, caSigner := newKey(t)
+	userKey, _ := newKey(t)
+	otherKey, _ := newKey(t)
+	path := filepath.Join(t.TempDir(), "ca.pub")
+	if err := os.WriteFile(path, []byte(authorizedKeys(caSigner.PublicKey())), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert := &gossh.Certificate{
+		Key:             userKey,
+		CertType:        gossh.UserCert,
+		ValidPrincipals: []string{"alice"},
+		ValidBefore:     gossh.CertTimeInfinity,
+		Permissions: gossh.Permissions{
+			Extensions: map[string]string{ExtensionImage: "ubuntu:22.04"},
+		},
+	}
+	if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := NewCertificateAuthority(path, acceptAll{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := newContext("alice", "192.0.2.1")
+	if !ca.Authenticate(ctx, cert) {
+		t.Fatal("got the certificate rejected")
+	}
+	// The client offered the certificate, but authenticated with another
+	// key.
+	ctx.SetValue(ssh.ContextKeyPublicKey, otherKey)
+	if ext := Extensions(ctx); ext != nil {
+		t.Errorf("got extensions %v, want none", ext)
+	}
+}
+
+func TestNewCertificateAuthorityWithoutKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.pub")
+	if err := os.WriteFile(path, []byte("# no keys\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCertificateAuthority(path, nil); err == nil {
+		t.Error("got no error loading a file without CA keys")
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+)
+
+// KeysDirectory authenticates users against a directory that holds an
+// authorized_keys formatted file per user, named after the user. Files are
+// reloaded when their modification time changes, so it works with a mounted
+// Kubernetes Secret.
+type KeysDirectory struct {
+	path string
+
+	mu    sync.Mutex
+	cache map[string]*authorizedKeysFile
+}
+
+type authorizedKeysFile struct {
+	modTime time.Time
+	keys    []ssh.PublicKey
+}
+
+// NewKeysDirectory returns a new KeysDirectory reading from path.
+func NewKeysDirectory(path string) *KeysDirectory {
+	return &KeysDirectory{
+		path:  path,
+		cache: make(map[string]*authorizedKeysFile),
+	}
+}
+
+// Authenticate implements Authenticator.
+func (kd *KeysDirectory) Authenticate(ctx ssh.Context, key ssh.PublicKey) bool {
+	user := username(ctx)
+	if user == "" || strings.HasPrefix(user, ".") || filepath.Base(user) != user {
+		return reject(ctx, key, "invalid username")
+	}
+
+	keys, err := kd.load(user)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return reject(ctx, key, "no authorized keys for user")
+		}
+		log.Error("Error reading authorized keys", "user", user, "error", err)
+		return reject(ctx, key, "error reading authorized keys")
+	}
+	if !containsKey(keys, key) {
+		return reject(ctx, key, "key not authorized")
+	}
+	return true
+}
+
+// Returns the keys for the user, reading the file again if it changed.
+func (kd *KeysDirectory) load(user string) ([]ssh.PublicKey, error) {
+	path := filepath.Join(kd.path, user)
+	info, err := os.Stat(path)
+	if err != nil {
+		kd.mu.Lock()
+		delete(kd.cache, user)
+		kd.mu.Unlock()
+		return nil, err
+	}
+
+	kd.mu.Lock()
+	defer kd.mu.Unlock()
+	if f, ok := kd.cache[user]; ok && f.modTime.Equal(info.ModTime()) {
+		return f.keys, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Loaded authorized keys", "user", user, "path", path)
+	f := &authorizedKeysFile{modTime: info.ModTime(), keys: parseAuthorizedKeys(data)}
+	kd.cache[user] = f
+	return f.keys, nil
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+
+	"github.com/ivanvc/boombox/internal/identity"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// The key in the Secret or ConfigMap data that holds the authorized keys.
+const authorizedKeysDataKey = "authorized_keys"
+
+// KubernetesKeys authenticates users against a Secret, or a ConfigMap, named
+// after the user with a prefix. The object is fetched on every attempt, so
+// changes are picked up right away.
+type KubernetesKeys struct {
+	client *k8s.Client
+	prefix string
+}
+
+// NewKubernetesKeys returns a new KubernetesKeys.
+func NewKubernetesKeys(client *k8s.Client, prefix string) *KubernetesKeys {
+	return &KubernetesKeys{client, prefix}
+}
+
+// Authenticate implements Authenticator.
+func (kk *KubernetesKeys) Authenticate(ctx ssh.Context, key ssh.PublicKey) bool {
+	name := kk.prefix + identity.ResourceName(username(ctx))
+	data, err := kk.load(name)
+	if err != nil {
+		log.Error("Error fetching authorized keys", "name", name, "error", err)
+		return reject(ctx, key, "error fetching authorized keys")
+	}
+	if data == nil {
+		return reject(ctx, key, "no authorized keys for user")
+	}
+	if !containsKey(parseAuthorizedKeys(data), key) {
+		return reject(ctx, key, "key not authorized")
+	}
+	return true
+}
+
+// Returns the authorized keys from the Secret, falling back to the ConfigMap.
+func (kk *KubernetesKeys) load(name string) ([]byte, error) {
+	secret, err := kk.client.GetSecret(name)
+	if err != nil {
+		return nil, err
+	}
+	if secret != nil {
+		return secret.Data[authorizedKeysDataKey], nil
+	}
+
+	cm, err := kk.client.GetConfigMap(name)
+	if err != nil {
+		return nil, err
+	}
+	if cm != nil {
+		return []byte(cm.Data[authorizedKeysDataKey]), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+
+	"github.com/ivanvc/boombox/internal/identity"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// UserGate only allows users that have an enabled BoomboxUser, and then
+// delegates the key check to the next Authenticator. If there's no next
+// Authenticator, the key is accepted.
+type UserGate struct {
+	users *k8s.UserRegistry
+	next  Authenticator
+}
+
+// NewUserGate returns a new UserGate.
+func NewUserGate(users *k8s.UserRegistry, next Authenticator) *UserGate {
+	return &UserGate{users, next}
+}
+
+// Authenticate implements Authenticator.
+func (ug *UserGate) Authenticate(ctx ssh.Context, key ssh.PublicKey) bool {
+	user, err := ug.users.Get(identity.ResourceName(username(ctx)))
+	if err != nil {
+		log.Error("Error fetching BoomboxUser", "user", ctx.User(), "error", err)
+		return reject(ctx, key, "error fetching BoomboxUser")
+	}
+	if user == nil {
+		return reject(ctx, key, "no BoomboxUser for user")
+	}
+	if user.Spec.Disabled {
+		return reject(ctx, key, "user is disabled")
+	}
+	if ug.next == nil {
+		return true
+	}
+	return ug.next.Authenticate(ctx, key)
+}
+
+// UserRegistryKeys authenticates users against the public keys in their
+// BoomboxUser.
+type UserRegistryKeys struct {
+	users *k8s.UserRegistry
+}
+
+// NewUserRegistryKeys returns a new UserRegistryKeys.
+func NewUserRegistryKeys(users *k8s.UserRegistry) *UserRegistryKeys {
+	return &UserRegistryKeys{users}
+}
+
+// Authenticate implements Authenticator.
+func (uk *UserRegistryKeys) Authenticate(ctx ssh.Context, key ssh.PublicKey) bool {
+	user, err := uk.users.Get(identity.ResourceName(username(ctx)))
+	if err != nil {
+		log.Error("Error fetching BoomboxUser", "user", ctx.User(), "error", err)
+		return reject(ctx, key, "error fetching BoomboxUser")
+	}
+	if user == nil {
+		return reject(ctx, key, "no BoomboxUser for user")
+	}
+	keys := parseAuthorizedKeys([]byte(strings.Join(user.Spec.PublicKeys, "\n")))
+	if !containsKey(keys, key) {
+		return reject(ctx, key, "key not authorized")
+	}
+	return true
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"flag"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -10,6 +13,34 @@ type Config struct {
 	HostKeyPath string
 	LogLevel    string
 
+	AuthMode              string
+	AuthorizedKeysPath    string
+	AuthorizedKeysPrefix  string
+	TrustedUserCAKeysPath string
+	UserRegistry          bool
+	DeniedUsernames       []string
+
+	PortForwardPod          bool
+	PortForwardAllowedHosts []string
+	PreviewListen           string
+	PreviewURL              string
+	PreviewSecret           string
+	PreviewViewers          []string
+	AgentForwarding         bool
+	EnvAllowList            []string
+	SessionMultiplexer      bool
+	Watchers                []string
+	IdleTimeout             time.Duration
+	MaxSessionDuration      time.Duration
+	SessionTimeoutWarning   time.Duration
+	ShutdownGracePeriod     time.Duration
+	DeletePodsOnShutdown    bool
+	DeleteFailedPods        bool
+	Recording               string
+	RecordingPath           string
+
+	Backend        string
+	LocalHomePath  string
 	Namespace      string
 	ContainerImage string
 	PVCSize        string
@@ -19,11 +50,50 @@ func Load() *Config {
 	c := new(Config)
 	flag.StringVar(&c.Listen, "listen", envOrDefault("BOOMBOX_LISTEN", ":2828"), "The address the server binds to.")
 	flag.StringVar(&c.HostKeyPath, "host-key-path", envOrDefault("BOOMBOX_HOST_KEY_PATH", ".ssh/boombox_ed25519"), "The host key path.")
+	flag.StringVar(&c.AuthMode, "auth-mode", envOrDefault("BOOMBOX_AUTH_MODE", "none"), "The authentication mode: none, authorized-keys, or kubernetes (default: none).")
+	flag.StringVar(&c.AuthorizedKeysPath, "authorized-keys-path", envOrDefault("BOOMBOX_AUTHORIZED_KEYS_PATH", ".ssh/authorized_keys.d"), "The directory holding an authorized_keys file per user (default: .ssh/authorized_keys.d).")
+	flag.StringVar(&c.AuthorizedKeysPrefix, "authorized-keys-prefix", envOrDefault("BOOMBOX_AUTHORIZED_KEYS_PREFIX", "boombox-keys-"), "The name prefix of the per user Secret or ConfigMap holding the authorized keys (default: boombox-keys-).")
+	flag.StringVar(&c.TrustedUserCAKeysPath, "trusted-user-ca-keys-path", envOrDefault("BOOMBOX_TRUSTED_USER_CA_KEYS_PATH", ""), "The file with the CA public keys trusted to sign user certificates.")
+	flag.BoolVar(&c.UserRegistry, "user-registry", envOrDefaultBool("BOOMBOX_USER_REGISTRY", false), "Manage users with BoomboxUser resources (default: false).")
+	deniedUsernames := flag.String("denied-usernames", envOrDefault("BOOMBOX_DENIED_USERNAMES", "root,daemon,bin,sys,sync,games,man,lp,mail,news,uucp,proxy,www-data,backup,list,irc,gnats,nobody,docker,linuxbrew"), "Comma separated list of usernames that are not allowed to log in.")
+	flag.BoolVar(&c.PortForwardPod, "port-forward-pod", envOrDefaultBool("BOOMBOX_PORT_FORWARD_POD", true), "Allow forwarding ports to the user's Pod (default: true).")
+	portForwardAllowedHosts := flag.String("port-forward-allowed-hosts", envOrDefault("BOOMBOX_PORT_FORWARD_ALLOWED_HOSTS", ""), "Comma separated list of host patterns, with an optional port, users can forward ports to (i.e., *.svc.cluster.local:80).")
+	flag.StringVar(&c.PreviewListen, "preview-listen", envOrDefault("BOOMBOX_PREVIEW_LISTEN", ":8080"), "The address the preview HTTP proxy binds to (default: :8080).")
+	flag.StringVar(&c.PreviewURL, "preview-url", envOrDefault("BOOMBOX_PREVIEW_URL", ""), "The base URL for the previews, i.e., https://preview.example.com (default: empty, previews are disabled).")
+	flag.StringVar(&c.PreviewSecret, "preview-secret", envOrDefault("BOOMBOX_PREVIEW_SECRET", ""), "The secret to sign the preview login tokens, required with more than one replica (default: random).")
+	previewViewers := flag.String("preview-viewers", envOrDefault("BOOMBOX_PREVIEW_VIEWERS", ""), "Comma separated list of usernames allowed to view any user's private previews.")
+	flag.BoolVar(&c.AgentForwarding, "agent-forwarding", envOrDefaultBool("BOOMBOX_AGENT_FORWARDING", false), "Allow forwarding the SSH agent into the Pod, for sessions that request it (default: false).")
+	envAllowList := flag.String("env-allow-list", envOrDefault("BOOMBOX_ENV_ALLOW_LIST", "LANG,LC_*,COLORTERM,EDITOR,VISUAL,GIT_*"), "Comma separated list of environment variables, or patterns, passed from the client to the user's shell.")
+	flag.BoolVar(&c.SessionMultiplexer, "session-multiplexer", envOrDefaultBool("BOOMBOX_SESSION_MULTIPLEXER", false), "Run the user shells in tmux, so sessions can be resumed (default: false).")
+	watchers := flag.String("watchers", envOrDefault("BOOMBOX_WATCHERS", ""), "Comma separated list of usernames allowed to watch any user's session.")
+	flag.DurationVar(&c.IdleTimeout, "idle-timeout", envOrDefaultDuration("BOOMBOX_IDLE_TIMEOUT", 0), "End interactive sessions without input for this long, i.e., 2h (default: 0, disabled).")
+	flag.DurationVar(&c.MaxSessionDuration, "max-session-duration", envOrDefaultDuration("BOOMBOX_MAX_SESSION_DURATION", 0), "End interactive sessions after this long, i.e., 12h (default: 0, disabled).")
+	flag.DurationVar(&c.SessionTimeoutWarning, "session-timeout-warning", envOrDefaultDuration("BOOMBOX_SESSION_TIMEOUT_WARNING", 5*time.Minute), "How long before ending a session to warn the user (default: 5m).")
+	flag.DurationVar(&c.ShutdownGracePeriod, "shutdown-grace-period", envOrDefaultDuration("BOOMBOX_SHUTDOWN_GRACE_PERIOD", 30*time.Second), "How long to wait for the sessions to finish when shutting down (default: 30s).")
+	flag.BoolVar(&c.DeletePodsOnShutdown, "delete-pods-on-shutdown", envOrDefaultBool("BOOMBOX_DELETE_PODS_ON_SHUTDOWN", true), "Delete the Pods of the active sessions when shutting down (default: true).")
+	flag.BoolVar(&c.DeleteFailedPods, "delete-failed-pods", envOrDefaultBool("BOOMBOX_DELETE_FAILED_PODS", true), "Delete the Pods that fail to start, so the next login creates them again (default: true).")
+	flag.StringVar(&c.Recording, "recording", envOrDefault("BOOMBOX_RECORDING", "off"), "Record the interactive sessions: off, opt-in, or enforced (default: off).")
+	flag.StringVar(&c.RecordingPath, "recording-path", envOrDefault("BOOMBOX_RECORDING_PATH", "recordings"), "The directory to store the session recordings (default: recordings).")
+	flag.StringVar(&c.Backend, "backend", envOrDefault("BOOMBOX_BACKEND", "kubernetes"), "Where the boxes run: kubernetes, or local for development without a cluster (default: kubernetes).")
+	flag.StringVar(&c.LocalHomePath, "local-home-path", envOrDefault("BOOMBOX_LOCAL_HOME_PATH", "homes"), "The directory holding the users' home directories, with the local backend (default: homes).")
 	flag.StringVar(&c.Namespace, "namespace", envOrDefault("BOOMBOX_NAMESPACE", "default"), "The namespace to create PVCs and Pods (default: default).")
 	flag.StringVar(&c.ContainerImage, "container-image", envOrDefault("BOOMBOX_CONTAINER_IMAGE", "ubuntu"), "The Docker image to use in the container (default: ubuntu).")
 	flag.StringVar(&c.PVCSize, "pvc-size", envOrDefault("BOOMBOX_PVC_SIZE", "10Gi"), "The size for the user PVC with units (default: 10Gi).")
 	flag.StringVar(&c.LogLevel, "log-level", envOrDefault("BOOMBOX_LOG_LEVEL", "info"), "The log level. (default: INFO).")
 	flag.Parse()
+	c.DeniedUsernames = strings.Split(*deniedUsernames, ",")
+	if *envAllowList != "" {
+		c.EnvAllowList = strings.Split(*envAllowList, ",")
+	}
+	if *watchers != "" {
+		c.Watchers = strings.Split(*watchers, ",")
+	}
+	if *previewViewers != "" {
+		c.PreviewViewers = strings.Split(*previewViewers, ",")
+	}
+	if *portForwardAllowedHosts != "" {
+		c.PortForwardAllowedHosts = strings.Split(*portForwardAllowedHosts, ",")
+	}
 
 	return c
 }
@@ -34,3 +104,21 @@ func envOrDefault(variable, fallback string) string {
 	}
 	return fallback
 }
+
+func envOrDefaultBool(variable string, fallback bool) bool {
+	if v, ok := os.LookupEnv(variable); ok {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func envOrDefaultDuration(variable string, fallback time.Duration) time.Duration {
+	if v, ok := os.LookupEnv(variable); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,148 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxUsernameLength     = 32
+	maxResourceNameLength = 63
+	hashSuffixLength      = 8
+)
+
+var (
+	usernameRegexp    = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+	numericRegexp     = regexp.MustCompile(`^[0-9]+$`)
+	invalidNameRegexp = regexp.MustCompile(`[^a-z0-9-]+`)
+	selectorArgRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	hashSuffixRegexp  = regexp.MustCompile(`-[0-9a-f]{8}$`)
+)
+
+// SelectorResume resumes a multiplexer session (i.e., alice+resume, or
+// alice+resume:0 for a given session).
+const SelectorResume = "resume"
+
+// SelectorWatch watches another user's session (i.e., alice+watch:bob).
+const SelectorWatch = "watch"
+
+var selectorKinds = map[string]bool{
+	SelectorResume: true,
+	SelectorWatch:  true,
+}
+
+// Selector is the part of the SSH login after the username and a +, that
+// selects what the session does.
+type Selector struct {
+	Kind string
+	Arg  string
+}
+
+// Identity is a validated user, with the name used for its Kubernetes
+// resources.
+type Identity struct {
+	Username     string
+	ResourceName string
+	Selector     Selector
+}
+
+// Username returns the username of the SSH login, without the selector.
+func Username(login string) string {
+	username, _, _ := strings.Cut(login, "+")
+	return username
+}
+
+// Returns the Selector of the SSH login, or an error if it's not valid.
+func parseSelector(login string) (Selector, error) {
+	_, raw, ok := strings.Cut(login, "+")
+	if !ok {
+		return Selector{}, nil
+	}
+	kind, arg, hasArg := strings.Cut(raw, ":")
+	if !selectorKinds[kind] {
+		return Selector{}, fmt.Errorf("unknown selector %q", kind)
+	}
+	if hasArg && !selectorArgRegexp.MatchString(arg) {
+		return Selector{}, fmt.Errorf("invalid selector argument %q", arg)
+	}
+	return Selector{Kind: kind, Arg: arg}, nil
+}
+
+// Policy validates SSH usernames, so they can be used as Unix usernames and
+// mapped to Kubernetes resource names.
+type Policy struct {
+	denied map[string]bool
+}
+
+// NewPolicy returns a new Policy that rejects the denied usernames.
+func NewPolicy(denied []string) *Policy {
+	p := &Policy{denied: make(map[string]bool)}
+	for _, name := range denied {
+		if name = strings.TrimSpace(name); name != "" {
+			p.denied[name] = true
+		}
+	}
+	return p
+}
+
+// Validate returns an error if the SSH login isn't allowed, either because of
+// the username or the selector.
+func (p *Policy) Validate(login string) error {
+	if _, err := parseSelector(login); err != nil {
+		return err
+	}
+	username := Username(login)
+	if username == "" {
+		return fmt.Errorf("username is empty")
+	}
+	if len(username) > maxUsernameLength {
+		return fmt.Errorf("username %q is longer than %d characters", username, maxUsernameLength)
+	}
+	if !usernameRegexp.MatchString(username) || numericRegexp.MatchString(username) {
+		return fmt.Errorf("username %q is not a valid Unix username", username)
+	}
+	// It would look like the resource name of a username that was
+	// normalized, see ResourceName.
+	if hashSuffixRegexp.MatchString(username) {
+		return fmt.Errorf("username %q can't end with a dash and 8 hexadecimal characters", username)
+	}
+	if p.denied[username] {
+		return fmt.Errorf("username %q is not allowed", username)
+	}
+	return nil
+}
+
+// Resolve validates the SSH login, and returns its Identity.
+func (p *Policy) Resolve(login string) (*Identity, error) {
+	if err := p.Validate(login); err != nil {
+		return nil, err
+	}
+	selector, _ := parseSelector(login)
+	username := Username(login)
+	return &Identity{Username: username, ResourceName: ResourceName(username), Selector: selector}, nil
+}
+
+// ResourceName returns a DNS-1123 label derived from the username. When the
+// username isn't a valid label as is, it's lowercased, invalid characters are
+// replaced, and a hash of the original username is appended. Validate rejects
+// the usernames that are valid labels ending like that hash, so different valid
+// usernames don't map to the same name, unless their hashes collide.
+func ResourceName(username string) string {
+	name := strings.Trim(invalidNameRegexp.ReplaceAllString(strings.ToLower(username), "-"), "-")
+	if name == username && len(name) <= maxResourceNameLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(username))
+	suffix := hex.EncodeToString(sum[:])[:hashSuffixLength]
+	if maxLength := maxResourceNameLength - hashSuffixLength - 1; len(name) > maxLength {
+		name = strings.TrimRight(name[:maxLength], "-")
+	}
+	if name == "" {
+		return "u-" + suffix
+	}
+	return name + "-" + suffix
+}
@@ -0,0 +1,112 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var labelRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+func TestValidate(t *testing.T) {
+	policy := NewPolicy([]string{"root", " admin "})
+
+	tests := []struct {
+		login   string
+		wantErr bool
+	}{
+		{"alice", false},
+		{"Alice", false},
+		{"alice.smith", false},
+		{"_alice", false},
+		{"alice-2024", false},
+		{"alice-deadbee", false},
+		{"alice-DEADBEEF", false},
+		{"alice+resume", false},
+		{"alice+resume:0", false},
+		{"alice+watch:bob", false},
+		{"", true},
+		{"+resume", true},
+		{"1000", true},
+		{"-alice", true},
+		{".alice", true},
+		{"alice/bob", true},
+		{strings.Repeat("a", maxUsernameLength+1), true},
+		{"root", true},
+		{"admin", true},
+		{"alice+unknown", true},
+		{"alice+watch:bob/carol", true},
+		{"alice-deadbeef", true},
+		{"u-0123abcd", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.login, func(t *testing.T) {
+			if err := policy.Validate(tt.login); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	id, err := NewPolicy(nil).Resolve("Alice+watch:bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Username: "Alice", ResourceName: ResourceName("Alice"), Selector: Selector{Kind: SelectorWatch, Arg: "bob"}}
+	if *id != want {
+		t.Errorf("got %+v, want %+v", *id, want)
+	}
+}
+
+func TestResourceName(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"alice", "alice"},
+		{"alice-2024", "alice-2024"},
+		{"Alice", "alice-" + hashSuffix("Alice")},
+		{"alice.smith", "alice-smith-" + hashSuffix("alice.smith")},
+		{"_alice_", "alice-" + hashSuffix("_alice_")},
+		{"___", "u-" + hashSuffix("___")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			if got := ResourceName(tt.username); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceNameIsUniqueForValidUsernames(t *testing.T) {
+	policy := NewPolicy(nil)
+	usernames := []string{
+		"alice", "Alice", "ALICE", "alice.", "alice_", "_alice", "a.lice", "a_lice", "a-lice",
+		"___", "...", "_", "u", "alice-" + hashSuffix("Alice"), "u-" + hashSuffix("___"),
+		strings.Repeat("a", maxUsernameLength), strings.Repeat("A", maxUsernameLength),
+	}
+	seen := make(map[string]string)
+	for _, username := range usernames {
+		if policy.Validate(username) != nil {
+			continue
+		}
+		name := ResourceName(username)
+		if !labelRegexp.MatchString(name) || len(name) > maxResourceNameLength {
+			t.Errorf("%q maps to %q, which is not a DNS-1123 label", username, name)
+		}
+		if other, ok := seen[name]; ok {
+			t.Errorf("%q and %q both map to %q", username, other, name)
+		}
+		seen[name] = username
+	}
+}
+
+// Returns the hash ResourceName appends to the normalized username.
+func hashSuffix(username string) string {
+	sum := sha256.Sum256([]byte(username))
+	return hex.EncodeToString(sum[:])[:hashSuffixLength]
+}
@@ -0,0 +1,316 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// The path, in the preview URL host, that exchanges a login token for a
+	// session cookie.
+	loginPath = "/_boombox/login"
+	// The path, in the preview URL host, that sends the logged in viewer to a
+	// preview with a token for its host.
+	authorizePath = "/_boombox/authorize"
+	// The path, in a preview host, that exchanges the token for its host for
+	// the preview's session cookie.
+	callbackPath = "/_boombox/callback"
+	// The cookie holding the viewer's session token. Each host has its own,
+	// so a preview can't read or set the cookie of another one.
+	cookieName = "boombox_preview"
+
+	loginTTL   = 5 * time.Minute
+	hostTTL    = time.Minute
+	sessionTTL = 12 * time.Hour
+)
+
+// Target is where a preview is served from.
+type Target interface {
+	// Public returns true if anyone can view the preview.
+	Public() bool
+	// Dial opens a connection to the preview.
+	Dial(ctx context.Context) (net.Conn, error)
+}
+
+// ResolveFunc returns the Target for a user's port, where user is the user's
+// resource name.
+type ResolveFunc func(user string, port uint16) (Target, error)
+
+// AuthorizeFunc returns an error if the username can't view previews.
+type AuthorizeFunc func(username string) error
+
+// ShareFunc returns an error if the viewer, a username, can't view the private
+// previews of user, a resource name.
+type ShareFunc func(viewer, user string) error
+
+// Proxy is an HTTP reverse proxy that serves the previews at
+// <port>-<user>.<domain>.
+type Proxy struct {
+	url       *url.URL
+	domain    string
+	signer    *Signer
+	resolve   ResolveFunc
+	authorize AuthorizeFunc
+	share     ShareFunc
+}
+
+// New returns a new *Proxy, for previews under the host of rawURL (i.e.,
+// https://preview.example.com). Tokens are signed with secret. Private previews
+// are only served to the viewers that share allows.
+func New(rawURL, secret string, resolve ResolveFunc, authorize AuthorizeFunc, share ShareFunc) (*Proxy, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid preview URL %q", rawURL)
+	}
+	signer, err := NewSigner(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &Proxy{
+		url:       u,
+		domain:    strings.ToLower(u.Hostname()),
+		signer:    signer,
+		resolve:   resolve,
+		authorize: authorize,
+		share:     share,
+	}, nil
+}
+
+// URL returns the preview URL for the user's port.
+func (p *Proxy) URL(user string, port uint16) string {
+	u := *p.url
+	u.Host = fmt.Sprintf("%d-%s.%s", port, user, p.url.Host)
+	u.Path = "/"
+	return u.String()
+}
+
+// LoginURL returns a short lived URL that logs in the username as a viewer.
+func (p *Proxy) LoginURL(username string) string {
+	u := *p.url
+	u.Path = loginPath
+	u.RawQuery = url.Values{"token": {p.signer.Sign(tokenKindLogin, username, loginTTL)}}.Encode()
+	return u.String()
+}
+
+// ServeHTTP implements http.Handler.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.isURLHost(r.Host) {
+		switch r.URL.Path {
+		case loginPath:
+			p.login(w, r)
+		case authorizePath:
+			p.authorizeHost(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	user, port, ok := p.parseHost(r.Host)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Path == callbackPath {
+		p.callback(w, r, user, port)
+		return
+	}
+	target, err := p.resolve(user, port)
+	if err != nil {
+		log.Error("Error resolving preview", "user", user, "port", port, "error", err)
+		http.Error(w, "Preview not available", http.StatusBadGateway)
+		return
+	}
+	if target == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !target.Public() {
+		viewer, err := p.viewer(r, hostKind(tokenKindSession, user, port))
+		if err != nil {
+			p.redirectToAuthorize(w, r)
+			return
+		}
+		if err := p.share(viewer, user); err != nil {
+			log.Debug("Rejected preview viewer", "user", user, "port", port, "viewer", viewer, "error", err)
+			http.Error(w, "This preview is private, and it's not shared with you.", http.StatusForbidden)
+			return
+		}
+		log.Debug("Serving preview", "user", user, "port", port, "viewer", viewer)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = net.JoinHostPort("localhost", strconv.Itoa(int(port)))
+			removeCookie(req, cookieName)
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return target.Dial(ctx)
+			},
+			DisableKeepAlives: true,
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Debug("Error proxying preview", "user", user, "port", port, "error", err)
+			http.Error(w, "Preview not available", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// Exchanges the login token for a session cookie for the preview URL host,
+// which the previews use to get their own.
+func (p *Proxy) login(w http.ResponseWriter, r *http.Request) {
+	username, err := p.signer.Verify(tokenKindLogin, r.URL.Query().Get("token"))
+	if err == nil {
+		err = p.authorize(username)
+	}
+	if err != nil {
+		http.Error(w, "Invalid login link: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	p.setSessionCookie(w, p.signer.Sign(tokenKindSession, username, sessionTTL))
+	log.Info("Preview viewer logged in", "user", username)
+	fmt.Fprintf(w, "Logged in as %s, you can now open the previews.\n", username)
+}
+
+// Sends a viewer without a session for a private preview to the preview URL
+// host, to get one. It's a page instead of a redirect, so the browser sends
+// the session cookie even if the viewer came from another site.
+func (p *Proxy) redirectToAuthorize(w http.ResponseWriter, r *http.Request) {
+	u := *p.url
+	u.Path = authorizePath
+	u.RawQuery = url.Values{"host": {r.Host}, "path": {r.URL.RequestURI()}}.Encode()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<meta http-equiv="refresh" content="0;url=%s">
+<p>This preview is private. To log in, run ssh -s &lt;you&gt;@&lt;boombox&gt; preview-login, and open the URL it prints.</p>
+`, html.EscapeString(u.String()))
+}
+
+// Sends the logged in viewer back to the preview host, with a short lived
+// token for it.
+func (p *Proxy) authorizeHost(w http.ResponseWriter, r *http.Request) {
+	host, path := r.URL.Query().Get("host"), r.URL.Query().Get("path")
+	user, port, ok := p.parseHost(host)
+	if !ok || !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		http.Error(w, "Invalid preview", http.StatusBadRequest)
+		return
+	}
+	viewer, err := p.viewer(r, tokenKindSession)
+	if err != nil {
+		http.Error(w, "This preview is private. To log in, run ssh -s <you>@<boombox> preview-login, and open the URL it prints.", http.StatusUnauthorized)
+		return
+	}
+
+	u := *p.url
+	u.Host = host
+	u.Path = callbackPath
+	u.RawQuery = url.Values{
+		"token": {p.signer.Sign(hostKind(tokenKindHost, user, port), viewer, hostTTL)},
+		"path":  {path},
+	}.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// Exchanges the token for the preview host for its session cookie, and sends
+// the viewer to the preview.
+func (p *Proxy) callback(w http.ResponseWriter, r *http.Request, user string, port uint16) {
+	path := r.URL.Query().Get("path")
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		path = "/"
+	}
+	username, err := p.signer.Verify(hostKind(tokenKindHost, user, port), r.URL.Query().Get("token"))
+	if err == nil {
+		err = p.authorize(username)
+	}
+	if err != nil {
+		http.Error(w, "Invalid login link: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	p.setSessionCookie(w, p.signer.Sign(hostKind(tokenKindSession, user, port), username, sessionTTL))
+	http.Redirect(w, r, path, http.StatusFound)
+}
+
+// Sets the session cookie for the request's host only, not its subdomains.
+func (p *Proxy) setSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		Secure:   p.url.Scheme == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// Returns the username of the request's viewer, or an error if there's no
+// valid session token of the kind.
+func (p *Proxy) viewer(r *http.Request, kind string) (string, error) {
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return "", err
+	}
+	username, err := p.signer.Verify(kind, cookie.Value)
+	if err != nil {
+		return "", err
+	}
+	return username, p.authorize(username)
+}
+
+// Returns true if host is the preview URL host.
+func (p *Proxy) isURLHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".") == p.domain
+}
+
+// Returns the user and port from a <port>-<user>.<domain> host.
+func (p *Proxy) parseHost(host string) (string, uint16, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	label, ok := strings.CutSuffix(strings.ToLower(host), "."+p.domain)
+	if !ok || strings.Contains(label, ".") {
+		return "", 0, false
+	}
+	rawPort, user, ok := strings.Cut(label, "-")
+	if !ok || user == "" {
+		return "", 0, false
+	}
+	port, err := strconv.ParseUint(rawPort, 10, 16)
+	if err != nil || port == 0 {
+		return "", 0, false
+	}
+	return user, uint16(port), true
+}
+
+// Removes the cookie from the request, so it's not sent to the preview.
+func removeCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			r.AddCookie(c)
+		}
+	}
+}
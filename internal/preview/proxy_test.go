@@ -0,0 +1,209 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testTarget serves the previews from an HTTP test server.
+type testTarget struct {
+	addr   string
+	public bool
+}
+
+func (t *testTarget) Public() bool { return t.public }
+
+func (t *testTarget) Dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", t.addr)
+}
+
+func TestProxyAccess(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie(cookieName); err == nil {
+			t.Error("got the session cookie in the preview")
+		}
+		fmt.Fprint(w, "preview")
+	}))
+	defer app.Close()
+
+	resolve := func(user string, port uint16) (Target, error) {
+		return &testTarget{addr: app.Listener.Addr().String(), public: port == 8000}, nil
+	}
+	authorize := func(username string) error {
+		if username == "mallory" {
+			return fmt.Errorf("user %q is disabled", username)
+		}
+		return nil
+	}
+	// alice shares her previews with bob.
+	share := func(viewer, user string) error {
+		if viewer == user || (viewer == "bob" && user == "alice") {
+			return nil
+		}
+		return fmt.Errorf("not shared")
+	}
+	p, err := New("https://preview.example.com", "secret", resolve, authorize, share)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		host   string
+		viewer string
+		want   int
+	}{
+		{"owner", "3000-alice.preview.example.com", "alice", http.StatusOK},
+		{"shared viewer", "3000-alice.preview.example.com", "bob", http.StatusOK},
+		{"viewer not shared", "3000-alice.preview.example.com", "carol", http.StatusForbidden},
+		{"not shared the other way", "3000-bob.preview.example.com", "alice", http.StatusForbidden},
+		{"disabled viewer", "3000-mallory.preview.example.com", "mallory", http.StatusUnauthorized},
+		{"without a login", "3000-alice.preview.example.com", "", http.StatusUnauthorized},
+		{"login of another preview", "3001-alice.preview.example.com", "alice", http.StatusUnauthorized},
+		{"public preview", "8000-alice.preview.example.com", "", http.StatusOK},
+		{"unknown host", "alice.preview.example.com", "alice", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://"+tt.host+"/", nil)
+			if tt.viewer != "" {
+				// The session is for port 3000 of the host's user.
+				user, _, _ := p.parseHost(tt.host)
+				r.AddCookie(&http.Cookie{Name: cookieName, Value: p.signer.Sign(hostKind(tokenKindSession, user, 3000), tt.viewer, sessionTTL)})
+			}
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want == http.StatusOK && w.Body.String() != "preview" {
+				t.Errorf("got body %q, want the preview", w.Body)
+			}
+		})
+	}
+}
+
+func TestProxyLogin(t *testing.T) {
+	p, err := New("https://preview.example.com", "secret", nil, func(string) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, p.LoginURL("alice"), nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != cookieName {
+		t.Fatalf("got cookies %v, want the session cookie", cookies)
+	}
+	if cookies[0].Domain != "" || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Errorf("got cookie %v, want a strict cookie for the host only", cookies[0])
+	}
+	if viewer, err := p.signer.Verify(tokenKindSession, cookies[0].Value); err != nil || viewer != "alice" {
+		t.Errorf("got viewer %q, error %v, want alice", viewer, err)
+	}
+
+	// A token signed with another secret, i.e., by a replica without the
+	// same preview-secret, is rejected.
+	other, err := New("https://preview.example.com", "other secret", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest(http.MethodGet, other.LoginURL("alice"), nil)
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	body, _ := io.ReadAll(w.Body)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(string(body), "Invalid login link") {
+		t.Errorf("got status %d, %q, want the login rejected", w.Code, body)
+	}
+}
+
+func TestProxyPreviewLogin(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "preview "+r.URL.RequestURI())
+	}))
+	defer app.Close()
+	resolve := func(user string, port uint16) (Target, error) {
+		return &testTarget{addr: app.Listener.Addr().String()}, nil
+	}
+	share := func(viewer, user string) error { return nil }
+	p, err := New("https://preview.example.com", "secret", resolve, func(string) error { return nil }, share)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Returns the response to the URL, with the cookie if not nil.
+	get := func(rawURL string, cookie *http.Cookie) *http.Response {
+		r := httptest.NewRequest(http.MethodGet, rawURL, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	session := get(p.LoginURL("bob"), nil).Cookies()[0]
+
+	// Without a session for the preview, the page sends the viewer to get
+	// one.
+	resp := get("https://3000-alice.preview.example.com/app?page=1", nil)
+	body, _ := io.ReadAll(resp.Body)
+	match := regexp.MustCompile(`url=([^"]+)"`).FindSubmatch(body)
+	if resp.StatusCode != http.StatusUnauthorized || match == nil {
+		t.Fatalf("got status %d, %q, want the page to log in", resp.StatusCode, body)
+	}
+	authorizeURL := html.UnescapeString(string(match[1]))
+	if resp := get(authorizeURL, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %d without a session, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	resp = get(authorizeURL, session)
+	callbackURL, err := resp.Location()
+	if err != nil || callbackURL.Host != "3000-alice.preview.example.com" {
+		t.Fatalf("got status %d, location %v, want the preview's callback", resp.StatusCode, callbackURL)
+	}
+	// The token is only valid for the preview's host.
+	otherHost := *callbackURL
+	otherHost.Host = "3000-carol.preview.example.com"
+	if resp := get(otherHost.String(), nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %d for another preview, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	resp = get(callbackURL.String(), nil)
+	if location := resp.Header.Get("Location"); location != "/app?page=1" {
+		t.Errorf("got location %q, want the preview", location)
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 1 || cookies[0].Domain != "" || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("got cookies %v, want a strict cookie for the preview only", cookies)
+	}
+
+	resp = get("https://3000-alice.preview.example.com/app?page=1", cookies[0])
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(body) != "preview /app?page=1" {
+		t.Errorf("got status %d, %q, want the preview", resp.StatusCode, body)
+	}
+	if resp := get("https://3001-alice.preview.example.com/", cookies[0]); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %d for another preview, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	if resp := get("https://3000-alice.preview.example.com/", session); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %d with the preview URL host's session, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	// The viewer is only sent back to a path in the preview.
+	redirect := "https://preview.example.com" + authorizePath + "?host=3000-alice.preview.example.com&path=//evil.example.com"
+	if resp := get(redirect, session); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for another site, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
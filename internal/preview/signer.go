@@ -0,0 +1,84 @@
+package preview
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kinds of tokens, so a token for one use can't be used for another.
+const (
+	tokenKindLogin   = "login"
+	tokenKindHost    = "host"
+	tokenKindSession = "session"
+)
+
+// Returns the kind of the tokens for a preview host, so they're not valid for
+// other previews.
+func hostKind(kind, user string, port uint16) string {
+	return kind + ":" + strconv.Itoa(int(port)) + "-" + user
+}
+
+var errInvalidToken = errors.New("invalid token")
+
+// Signer signs and verifies the tokens that identify a viewer.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner returns a new *Signer for the secret. If secret is empty, a
+// random key is used, so tokens are only valid for this process.
+func NewSigner(secret string) (*Signer, error) {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &Signer{key}, nil
+}
+
+// Sign returns a token of the given kind for the username, valid for ttl.
+func (s *Signer) Sign(kind, username string, ttl time.Duration) string {
+	expiry := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(kind + "\x00" + username + "\x00" + expiry))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+// Verify returns the username of a token of the given kind, or an error if
+// it's not valid or it expired.
+func (s *Signer) Verify(kind, token string) (string, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", errInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(payload)) {
+		return "", errInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", errInvalidToken
+	}
+	fields := strings.Split(string(data), "\x00")
+	if len(fields) != 3 || fields[0] != kind {
+		return "", errInvalidToken
+	}
+	expiry, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return "", errors.New("expired token")
+	}
+	return fields[1], nil
+}
+
+func (s *Signer) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
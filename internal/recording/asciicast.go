@@ -0,0 +1,148 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Asciicast records a terminal session to a file in the asciicast v2 format
+// (https://docs.asciinema.org/manual/asciicast/v2/).
+type Asciicast struct {
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	start  time.Time
+	input  []byte
+	output []byte
+}
+
+type header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Path returns the path of a recording in dir, named after the user and the
+// session ID.
+func Path(dir, user, sessionID string, start time.Time) string {
+	return filepath.Join(dir, user, fmt.Sprintf("%s-%s.cast", start.UTC().Format("20060102T150405Z"), sessionID))
+}
+
+// NewAsciicast creates the recording file at path, and writes the header with
+// the initial terminal size, title, and env.
+func NewAsciicast(path string, width, height int, title string, env map[string]string) (*Asciicast, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Asciicast{file: f, w: bufio.NewWriter(f), start: time.Now()}
+	if err := a.writeJSON(header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: a.start.Unix(),
+		Title:     title,
+		Env:       env,
+	}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// Input records data sent by the user.
+func (a *Asciicast) Input(p []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.input = a.event("i", a.input, p)
+}
+
+// Output records data sent to the user's terminal.
+func (a *Asciicast) Output(p []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.output = a.event("o", a.output, p)
+}
+
+// Resize records a change in the terminal size.
+func (a *Asciicast) Resize(width, height uint16) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.writeEvent("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+// Close flushes and closes the recording. The bytes of an incomplete UTF-8
+// character that are still pending are written as they are, so nothing is
+// lost.
+func (a *Asciicast) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.input) > 0 {
+		a.writeEvent("i", string(a.input))
+		a.input = nil
+	}
+	if len(a.output) > 0 {
+		a.writeEvent("o", string(a.output))
+		a.output = nil
+	}
+	if err := a.w.Flush(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
+
+// Writes an event with the pending bytes and p, up to the last complete UTF-8
+// character, as JSON strings have to be valid UTF-8. It returns the bytes left
+// for the next event.
+func (a *Asciicast) event(code string, pending, p []byte) []byte {
+	data := append(pending, p...)
+	n := completeUTF8(data)
+	if n > 0 {
+		a.writeEvent(code, string(data[:n]))
+	}
+	return append([]byte(nil), data[n:]...)
+}
+
+func (a *Asciicast) writeEvent(code, data string) {
+	elapsed := time.Since(a.start).Seconds()
+	// Errors are kept by the bufio.Writer, and returned by Close.
+	a.writeJSON([]any{elapsed, code, data})
+	a.w.Flush()
+}
+
+func (a *Asciicast) writeJSON(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	a.w.Write(b)
+	return a.w.WriteByte('\n')
+}
+
+// Returns the length of data without a trailing incomplete UTF-8 character.
+// Invalid bytes are not held back.
+func completeUTF8(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(data)
+}
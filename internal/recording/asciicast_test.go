@@ -0,0 +1,130 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Returns the header and the events of the recording at path, without the
+// elapsed time.
+func readAsciicast(t *testing.T, path string) (header, [][2]string) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		t.Fatal("the recording has no header")
+	}
+	var h header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+		t.Fatal(err)
+	}
+	var events [][2]string
+	for scanner.Scan() {
+		var event []any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		if len(event) != 3 {
+			t.Fatalf("got event %v, want the time, code, and data", event)
+		}
+		if _, ok := event[0].(float64); !ok {
+			t.Fatalf("got event %v, want the elapsed time first", event)
+		}
+		events = append(events, [2]string{event[1].(string), event[2].(string)})
+	}
+	return h, events
+}
+
+func TestAsciicastHeader(t *testing.T) {
+	path := Path(t.TempDir(), "alice", "session", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	if filepath.Base(path) != "20240102T030405Z-session.cast" || filepath.Base(filepath.Dir(path)) != "alice" {
+		t.Errorf("got path %q, want it under the user, named after the time and session", path)
+	}
+	a, err := NewAsciicast(path, 80, 24, "alice", map[string]string{"TERM": "xterm-256color"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h, events := readAsciicast(t, path)
+	if h.Version != 2 || h.Width != 80 || h.Height != 24 || h.Title != "alice" || h.Env["TERM"] != "xterm-256color" {
+		t.Errorf("got header %+v, want version 2, 80x24, the title and env", h)
+	}
+	if time.Since(time.Unix(h.Timestamp, 0)) > time.Minute {
+		t.Errorf("got timestamp %d, want now", h.Timestamp)
+	}
+	if len(events) != 0 {
+		t.Errorf("got events %v, want none", events)
+	}
+	if _, err := NewAsciicast(path, 80, 24, "", nil); err == nil {
+		t.Error("got no error overwriting a recording")
+	}
+}
+
+func TestAsciicastEvents(t *testing.T) {
+	smile := "\U0001F600"
+	tests := []struct {
+		name   string
+		record func(a *Asciicast)
+		want   [][2]string
+	}{
+		{"output", func(a *Asciicast) {
+			a.Output([]byte("hello\r\n"))
+		}, [][2]string{{"o", "hello\r\n"}}},
+		{"input", func(a *Asciicast) {
+			a.Input([]byte("ls\r"))
+		}, [][2]string{{"i", "ls\r"}}},
+		{"resize", func(a *Asciicast) {
+			a.Resize(120, 40)
+		}, [][2]string{{"r", "120x40"}}},
+		{"split two byte character", func(a *Asciicast) {
+			a.Output([]byte("caf\xc3"))
+			a.Output([]byte("\xa9!"))
+		}, [][2]string{{"o", "caf"}, {"o", "é!"}}},
+		{"split four byte character", func(a *Asciicast) {
+			a.Output([]byte(smile[:1]))
+			a.Output([]byte(smile[1:3]))
+			a.Output([]byte(smile[3:]))
+		}, [][2]string{{"o", smile}}},
+		{"split input and output", func(a *Asciicast) {
+			a.Input([]byte(smile[:2]))
+			a.Output([]byte("ok"))
+			a.Input([]byte(smile[2:]))
+		}, [][2]string{{"o", "ok"}, {"i", smile}}},
+		{"invalid bytes", func(a *Asciicast) {
+			a.Output([]byte("a\x80b"))
+		}, [][2]string{{"o", "a�b"}}},
+		{"pending bytes on close", func(a *Asciicast) {
+			a.Output([]byte("done\xc3"))
+			a.Input([]byte(smile[:3]))
+		}, [][2]string{{"o", "done"}, {"i", "���"}, {"o", "�"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "session.cast")
+			a, err := NewAsciicast(path, 80, 24, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.record(a)
+			if err := a.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, events := readAsciicast(t, path); !reflect.DeepEqual(events, tt.want) {
+				t.Errorf("got events %q, want %q", events, tt.want)
+			}
+		})
+	}
+}
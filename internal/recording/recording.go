@@ -0,0 +1,23 @@
+// Package recording records the interactive sessions.
+package recording
+
+import "fmt"
+
+// The recording modes.
+const (
+	// ModeOff doesn't record sessions.
+	ModeOff = "off"
+	// ModeOptIn records the sessions of the users who opt in.
+	ModeOptIn = "opt-in"
+	// ModeEnforced records all the sessions.
+	ModeEnforced = "enforced"
+)
+
+// ValidateMode returns an error if mode is not a recording mode.
+func ValidateMode(mode string) error {
+	switch mode {
+	case ModeOff, ModeOptIn, ModeEnforced:
+		return nil
+	}
+	return fmt.Errorf("unknown recording mode %q", mode)
+}
@@ -1,7 +1,23 @@
 package server
 
-import "github.com/charmbracelet/ssh"
+import (
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
 
-func authHandler(ctx ssh.Context, key ssh.PublicKey) bool {
-	return true
+	"github.com/ivanvc/boombox/internal/auth"
+	"github.com/ivanvc/boombox/internal/identity"
+)
+
+func authHandler(policy *identity.Policy, authenticator auth.Authenticator) ssh.PublicKeyHandler {
+	return func(ctx ssh.Context, key ssh.PublicKey) bool {
+		if err := policy.Validate(ctx.User()); err != nil {
+			log.Warn("Rejected username", "user", ctx.User(), "remote-addr", ctx.RemoteAddr(), "error", err)
+			return false
+		}
+		if !authenticator.Authenticate(ctx, key) {
+			return false
+		}
+		log.Debug("Accepted public key", "user", ctx.User(), "remote-addr", ctx.RemoteAddr())
+		return true
+	}
 }
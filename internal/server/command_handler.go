@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/exec"
+
+	"github.com/ivanvc/boombox/internal/config"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+	"github.com/ivanvc/boombox/internal/ui/common"
+)
+
+// The exit status sent to the client when boombox fails to run the command.
+const commandErrorExitStatus = 255
+
+// How long to wait for the agent relay before running the command.
+const agentRelayTimeout = 5 * time.Second
+
+// Runs the command of sessions without a terminal (i.e., ssh boombox make
+// test) in the user's Pod. Provisioning progress goes to stderr, so stdout
+// only has the command output. Other sessions are passed to the next handler.
+func commandMiddleware(server *Server, cfg *config.Config, client k8s.Backend, users *k8s.UserRegistry) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(sess ssh.Session) {
+			if _, _, active := sess.Pty(); active || len(sess.Command()) == 0 {
+				next(sess)
+				return
+			}
+
+			common, err := newCommon(server, cfg, client, users, sess)
+			if err != nil {
+				log.Warn("Rejected session", "user", sess.User(), "error", err)
+				wish.Fatalln(sess, err)
+				return
+			}
+
+			server.RegisterSession(common.ResourceName, sess.Context().SessionID())
+			defer server.DeregisterSession(common.ResourceName, sess.Context().SessionID())
+			defer releasePod(server, client, common.ResourceName, sess.Context().SessionID())
+			sess.Exit(runCommand(common, sess))
+		}
+	}
+}
+
+// Provisions the user's Pod, and runs the session command in it. It returns
+// the command exit status.
+func runCommand(cmn *common.Common, sess ssh.Session) int {
+	stderr := sess.Stderr()
+	pod, err := provisionPod(cmn, stderr)
+	if err != nil {
+		log.Error("Error provisioning pod", "user", cmn.User, "error", err)
+		fmt.Fprintln(stderr, "Error:", err)
+		return commandErrorExitStatus
+	}
+
+	if cmn.AgentForwarding() {
+		startAgentRelay(cmn, pod)
+	}
+
+	// The command is stopped if the client disconnects.
+	err = cmn.Client.NewCommand(pod, cmn.User, sess.RawCommand(), cmn.Environ(), sess, sess, stderr).Run(sess.Context())
+	var exitErr exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+	if err != nil {
+		log.Error("Error running command", "user", cmn.User, "error", err)
+		fmt.Fprintln(stderr, "Error:", err)
+		return commandErrorExitStatus
+	}
+	return 0
+}
+
+// Starts relaying the agent socket in the Pod for the session, and waits for
+// it to listen, so the command can use it right away.
+func startAgentRelay(cmn *common.Common, pod *corev1.Pod) {
+	ready, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := cmn.Client.NewAgentRelay(pod, cmn.User, cmn.AgentSocket(), cmn.OpenAgent).Run(cmn.Session.Context(), ready); err != nil {
+			log.Error("Error forwarding agent", "user", cmn.User, "error", err)
+		}
+	}()
+	select {
+	case <-ready:
+	case <-done:
+	case <-time.After(agentRelayTimeout):
+		log.Warn("Timed out waiting for the agent relay", "user", cmn.User)
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/ivanvc/boombox/internal/config"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// The payload of a direct-tcpip channel, as in RFC 4254 section 7.2.
+type localForwardChannelData struct {
+	DestAddr   string
+	DestPort   uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// The connection to a forwarding destination.
+type forwardConn interface {
+	io.ReadWriteCloser
+	CloseWrite() error
+}
+
+// Handles direct-tcpip channels (i.e., ssh -L 8080:localhost:8080 boombox).
+// Destinations on localhost are forwarded to the user's running Pod, other
+// hosts are dialed from the server if the user's policy allows them.
+func directTCPIPHandler(server *Server, cfg *config.Config, client k8s.Backend, users *k8s.UserRegistry) ssh.ChannelHandler {
+	return func(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+		d := localForwardChannelData{}
+		if err := gossh.Unmarshal(newChan.ExtraData(), &d); err != nil {
+			newChan.Reject(gossh.ConnectionFailed, "error parsing forward data: "+err.Error())
+			return
+		}
+
+		if server.IsShuttingDown() {
+			newChan.Reject(gossh.Prohibited, "boombox is shutting down, try again in a moment")
+			return
+		}
+		id, account, err := resolveUser(server, users, ctx.User())
+		if err != nil {
+			log.Warn("Rejected port forwarding", "user", ctx.User(), "error", err)
+			newChan.Reject(gossh.Prohibited, err.Error())
+			return
+		}
+
+		policy := forwardingPolicy(cfg, account)
+		var target forwardConn
+		// Forwarding to the Pod is a session, so the Pod is kept while it's
+		// in use.
+		release := func() {}
+		if isLocalhost(d.DestAddr) {
+			if !policy.Pod {
+				newChan.Reject(gossh.Prohibited, "port forwarding to the box is not allowed")
+				return
+			}
+			server.RegisterSession(id.ResourceName, ctx.SessionID())
+			release = func() {
+				defer server.DeregisterSession(id.ResourceName, ctx.SessionID())
+				releasePod(server, client, id.ResourceName, ctx.SessionID())
+			}
+			target, err = dialPod(client, id.ResourceName, d.DestPort)
+		} else {
+			if !allowsHost(policy, d.DestAddr, d.DestPort) {
+				log.Warn("Rejected port forwarding", "user", id.Username, "host", d.DestAddr, "port", d.DestPort)
+				newChan.Reject(gossh.Prohibited, fmt.Sprintf("port forwarding to %s:%d is not allowed", d.DestAddr, d.DestPort))
+				return
+			}
+			target, err = dialHost(ctx, d.DestAddr, d.DestPort)
+		}
+		if err != nil {
+			log.Error("Error forwarding port", "user", id.Username, "host", d.DestAddr, "port", d.DestPort, "error", err)
+			newChan.Reject(gossh.ConnectionFailed, err.Error())
+			release()
+			return
+		}
+
+		ch, reqs, err := newChan.Accept()
+		if err != nil {
+			target.Close()
+			release()
+			return
+		}
+		go gossh.DiscardRequests(reqs)
+
+		log.Debug("Forwarding port", "user", id.Username, "host", d.DestAddr, "port", d.DestPort)
+		go func() {
+			defer release()
+			proxy(ctx, ch, target)
+		}()
+	}
+}
+
+// Returns the user's port forwarding policy, the BoomboxUser one takes
+// precedence over the configured one.
+func forwardingPolicy(cfg *config.Config, account *k8s.BoomboxUser) k8s.PortForwardingPolicy {
+	if account != nil && account.Spec.PortForwarding != nil {
+		return *account.Spec.PortForwarding
+	}
+	return k8s.PortForwardingPolicy{
+		Pod:          cfg.PortForwardPod,
+		AllowedHosts: cfg.PortForwardAllowedHosts,
+	}
+}
+
+// Returns true if the host and port match any of the policy's allowed hosts.
+// Patterns without a port, or with * as port, allow any port. IPv6 addresses
+// with a port are enclosed in brackets (i.e., [fd00::1]:5432).
+func allowsHost(policy k8s.PortForwardingPolicy, host string, port uint32) bool {
+	host = strings.ToLower(strings.TrimSuffix(trimBrackets(host), "."))
+	for _, pattern := range policy.AllowedHosts {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		hostPattern, portPattern, err := net.SplitHostPort(pattern)
+		if err != nil {
+			hostPattern, portPattern = trimBrackets(pattern), "*"
+		}
+		if portPattern != "*" && portPattern != strconv.Itoa(int(port)) {
+			continue
+		}
+		if ok, _ := path.Match(hostPattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the host is localhost, or any loopback or unspecified
+// address, which are forwarded to the Pod instead of the server.
+func isLocalhost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(trimBrackets(host), "."))
+	if host == "localhost" {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsUnspecified()
+}
+
+func trimBrackets(host string) string {
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host[1 : len(host)-1]
+	}
+	return host
+}
+
+// Dials the port in the user's running Pod.
+func dialPod(client k8s.Backend, name string, port uint32) (forwardConn, error) {
+	if port == 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+	pod, err := client.GetPod(name)
+	if err != nil {
+		return nil, err
+	}
+	if pod == nil || pod.Status.Phase != corev1.PodRunning {
+		return nil, fmt.Errorf("the box is not running, log in first")
+	}
+	return client.DialPod(pod, uint16(port))
+}
+
+func dialHost(ctx context.Context, host string, port uint32) (forwardConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.TCPConn), nil
+}
+
+// Copies data both ways between the channel and the target, until the target
+// closes the connection, or the SSH connection is closed (i.e., when the
+// server shuts down).
+func proxy(ctx context.Context, ch gossh.Channel, target forwardConn) {
+	var closeOnce sync.Once
+	var closeErr error
+	closeTarget := func() {
+		closeOnce.Do(func() { closeErr = target.Close() })
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			closeTarget()
+		case <-done:
+		}
+	}()
+
+	go func() {
+		io.Copy(target, ch)
+		target.CloseWrite()
+	}()
+	io.Copy(ch, target)
+	ch.Close()
+	closeTarget()
+	if closeErr != nil {
+		log.Debug("Port forwarding finished with error", "error", closeErr)
+	}
+}
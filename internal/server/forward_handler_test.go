@@ -0,0 +1,172 @@
+package server
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ivanvc/boombox/internal/config"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+	"github.com/ivanvc/boombox/internal/services/kubernetes/fake"
+)
+
+// Listens in a port of the loopback address, where the fake backend forwards
+// the Pod ports, and echoes the connections.
+func listenEcho(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func newForwardTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.PortForwardPod = true
+	}, fake.BoundPVC("alice"), fake.RunningPod("alice", "alice"))
+}
+
+// Sends ping through the connection, and waits for it back.
+func ping(t *testing.T, conn net.Conn) {
+	t.Helper()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("got %q, want ping", buf)
+	}
+}
+
+func TestForwardToPodHoldsLease(t *testing.T) {
+	ts := newForwardTestServer(t)
+	addr := listenEcho(t)
+	conn, err := ts.dial("alice").Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ping(t, conn)
+	if live := k8s.LiveSessionLeases(ts.pod("alice"), sessionLeaseTTL); live != 1 {
+		t.Errorf("got %d session leases, want 1", live)
+	}
+
+	conn.Close()
+	ts.waitFor("the Pod to be deleted", func() bool { return ts.pod("alice") == nil })
+}
+
+func TestForwardDuringShutdown(t *testing.T) {
+	ts := newForwardTestServer(t)
+	addr := listenEcho(t)
+	client := ts.dial("alice")
+	conn, err := client.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ping(t, conn)
+
+	done := make(chan struct{})
+	go func() {
+		ts.shutdown()
+		close(done)
+	}()
+	ts.waitFor("the shutdown", ts.IsShuttingDown)
+	if conn, err := client.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("got a new tunnel while shutting down")
+	}
+	// The open tunnel works until the grace period ends.
+	ping(t, conn)
+
+	select {
+	case <-done:
+	case <-time.After(waitTimeout):
+		t.Fatal("the shutdown didn't finish with an open tunnel")
+	}
+	if ts.pod("alice") != nil {
+		t.Error("the Pod was not deleted")
+	}
+}
+
+func TestAllowsHost(t *testing.T) {
+	policy := k8s.PortForwardingPolicy{AllowedHosts: []string{
+		"*.svc.cluster.local:80",
+		"postgres.db.svc.cluster.local:5432",
+		"cache.internal",
+		"[fd00::1]:6379",
+		"fd00::2",
+		"[fd00::3]",
+		"10.0.0.*:*",
+	}}
+
+	tests := []struct {
+		host string
+		port uint32
+		want bool
+	}{
+		{"web.default.svc.cluster.local", 80, true},
+		{"web.default.svc.cluster.local", 443, false},
+		{"POSTGRES.db.svc.cluster.local.", 5432, true},
+		{"postgres.db.svc.cluster.local", 5433, false},
+		{"cache.internal", 11211, true},
+		{"fd00::1", 6379, true},
+		{"[fd00::1]", 6379, true},
+		{"fd00::1", 6380, false},
+		{"fd00::2", 22, true},
+		{"fd00::3", 22, true},
+		{"10.0.0.7", 8080, true},
+		{"10.0.1.7", 8080, false},
+		{"example.com", 80, false},
+	}
+	for _, tt := range tests {
+		if got := allowsHost(policy, tt.host, tt.port); got != tt.want {
+			t.Errorf("allowsHost(%q, %d): got %v, want %v", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestIsLocalhost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"localhost", true},
+		{"LOCALHOST.", true},
+		{"127.0.0.1", true},
+		{"127.0.0.2", true},
+		{"127.1.2.3", true},
+		{"::1", true},
+		{"[::1]", true},
+		{"0:0:0:0:0:0:0:1", true},
+		{"::ffff:127.0.0.1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"10.0.0.1", false},
+		{"fd00::1", false},
+		{"localhost.example.com", false},
+		{"example.com", false},
+	}
+	for _, tt := range tests {
+		if got := isLocalhost(tt.host); got != tt.want {
+			t.Errorf("isLocalhost(%q): got %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+
+	"github.com/ivanvc/boombox/internal/identity"
+	"github.com/ivanvc/boombox/internal/preview"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// podPreview is a private preview served from a port in the user's Pod.
+type podPreview struct {
+	client k8s.Backend
+	name   string
+	port   uint16
+}
+
+// Public implements preview.Target.
+func (p *podPreview) Public() bool {
+	return false
+}
+
+// Dial implements preview.Target.
+func (p *podPreview) Dial(ctx context.Context) (net.Conn, error) {
+	conn, err := dialPod(p.client, p.name, uint32(p.port))
+	if err != nil {
+		return nil, err
+	}
+	return &streamConn{conn}, nil
+}
+
+// Returns the preview for the user's port. Ports forwarded with ssh -R take
+// precedence over the ports in the user's Pod.
+func (s *Server) resolvePreview(client k8s.Backend) preview.ResolveFunc {
+	return func(user string, port uint16) (preview.Target, error) {
+		if f := s.remoteForwards.get(user, port); f != nil {
+			return f, nil
+		}
+		return &podPreview{client: client, name: user, port: port}, nil
+	}
+}
+
+// Returns an error if the username is not allowed to log in.
+func (s *Server) authorizeViewer(username string) error {
+	_, account, err := resolveUser(s, s.users, username)
+	if err != nil {
+		return err
+	}
+	if account != nil && account.Spec.Disabled {
+		return fmt.Errorf("user %q is disabled", username)
+	}
+	return nil
+}
+
+// Returns an error if the viewer can't view the private previews of the user
+// (a resource name). Users can view their own previews, the configured preview
+// viewers can view anyone's, and the user's BoomboxUser can share them with
+// other users.
+func (s *Server) authorizePreview(viewer, user string) error {
+	id, err := s.policy.Resolve(viewer)
+	if err != nil {
+		return err
+	}
+	if id.ResourceName == user {
+		return nil
+	}
+	for _, name := range s.config.PreviewViewers {
+		if strings.TrimSpace(name) == id.Username {
+			return nil
+		}
+	}
+	if s.users != nil {
+		account, err := s.users.Get(user)
+		if err != nil {
+			return err
+		}
+		if account != nil {
+			for _, name := range account.Spec.PreviewViewers {
+				if name == id.Username {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("user %q is not allowed to view the previews of %q", id.Username, user)
+}
+
+// Prints a URL that logs in the user as a preview viewer (i.e., ssh -s
+// boombox preview-login).
+func previewLoginHandler(server *Server) ssh.SubsystemHandler {
+	return func(sess ssh.Session) {
+		if server.previews == nil {
+			wish.Fatalln(sess, "Previews are disabled")
+			return
+		}
+		if err := server.authorizeViewer(sess.User()); err != nil {
+			log.Warn("Rejected preview login", "user", sess.User(), "error", err)
+			wish.Fatalln(sess, err)
+			return
+		}
+		wish.Println(sess, server.previews.LoginURL(identity.Username(sess.User())))
+		sess.Exit(0)
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/ivanvc/boombox/internal/ui/common"
+	"github.com/ivanvc/boombox/internal/ui/common/state"
+)
+
+// Fetches or creates the user's Pod for sessions without the UI, writing the
+// progress to w. It returns the Pod once it's running.
+func provisionPod(cmn *common.Common, w io.Writer) (*corev1.Pod, error) {
+	image, err := cmn.ContainerImage()
+	if err != nil {
+		return nil, err
+	}
+
+	p := cmn.Actions.NewProvisioner(cmn.ResourceName, cmn.User, image, cmn.PVCSize(), cmn.Account)
+	p.OnStateChange = func(s state.State) {
+		if text := s.String(); text != "" {
+			fmt.Fprintln(w, text)
+		}
+	}
+	p.OnLogLine = func(line string) {
+		fmt.Fprintln(w, line)
+	}
+	pod, err := p.Run()
+	if err != nil {
+		cmn.DeleteFailedPod(err)
+	}
+	return pod, err
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// The bind address that makes a remote forward a public preview (i.e., ssh -R
+// public:3000:localhost:3000 boombox).
+const publicBindAddr = "public"
+
+// The payload of a tcpip-forward request, as in RFC 4254 section 7.1.
+type remoteForwardRequest struct {
+	BindAddr string
+	BindPort uint32
+}
+
+type remoteForwardSuccess struct {
+	BindPort uint32
+}
+
+// The payload of a forwarded-tcpip channel, as in RFC 4254 section 7.2.
+type remoteForwardChannelData struct {
+	DestAddr   string
+	DestPort   uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+type remoteForwardKey struct {
+	user string
+	port uint16
+}
+
+// A remoteForward is a port forwarded by an SSH client, served as a preview.
+type remoteForward struct {
+	conn     *gossh.ServerConn
+	ctx      ssh.Context
+	bindAddr string
+	bindPort uint32
+}
+
+// Public implements preview.Target.
+func (f *remoteForward) Public() bool {
+	return f.bindAddr == publicBindAddr
+}
+
+// Dial implements preview.Target. It opens a forwarded-tcpip channel to the
+// SSH client.
+func (f *remoteForward) Dial(ctx context.Context) (net.Conn, error) {
+	payload := gossh.Marshal(&remoteForwardChannelData{
+		DestAddr:   f.bindAddr,
+		DestPort:   f.bindPort,
+		OriginAddr: "127.0.0.1",
+		OriginPort: 0,
+	})
+	ch, reqs, err := f.conn.OpenChannel("forwarded-tcpip", payload)
+	if err != nil {
+		return nil, err
+	}
+	go gossh.DiscardRequests(reqs)
+	return &streamConn{ch}, nil
+}
+
+// remoteForwards holds the active remote forwards by user and port.
+type remoteForwards struct {
+	sync.Mutex
+	forwards map[remoteForwardKey]*remoteForward
+}
+
+// Returns the remote forward of the user for the port, or nil.
+func (r *remoteForwards) get(user string, port uint16) *remoteForward {
+	r.Lock()
+	defer r.Unlock()
+	return r.forwards[remoteForwardKey{user, port}]
+}
+
+// Adds the forward, returns false if the port is already forwarded.
+func (r *remoteForwards) add(user string, f *remoteForward) bool {
+	r.Lock()
+	defer r.Unlock()
+	key := remoteForwardKey{user, uint16(f.bindPort)}
+	if _, ok := r.forwards[key]; ok {
+		return false
+	}
+	r.forwards[key] = f
+	return true
+}
+
+// Removes the forward, if it was added from the same connection.
+func (r *remoteForwards) remove(user string, port uint16, ctx ssh.Context) {
+	r.Lock()
+	defer r.Unlock()
+	key := remoteForwardKey{user, port}
+	if f, ok := r.forwards[key]; ok && f.ctx == ctx {
+		delete(r.forwards, key)
+	}
+}
+
+// Handles tcpip-forward requests (i.e., ssh -R 3000:localhost:3000 boombox).
+// No port is opened in the server, the forward is served as a preview of the
+// user's port, and it's removed when the connection closes.
+func tcpipForwardHandler(server *Server) ssh.RequestHandler {
+	return func(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
+		if server.previews == nil {
+			return false, []byte("previews are disabled")
+		}
+		var payload remoteForwardRequest
+		if err := gossh.Unmarshal(req.Payload, &payload); err != nil {
+			return false, []byte(err.Error())
+		}
+		if payload.BindPort == 0 || payload.BindPort > 65535 {
+			return false, []byte("a port is required")
+		}
+		id, _, err := resolveUser(server, server.users, ctx.User())
+		if err != nil {
+			log.Warn("Rejected remote forwarding", "user", ctx.User(), "error", err)
+			return false, []byte(err.Error())
+		}
+
+		conn := ctx.Value(ssh.ContextKeyConn).(*gossh.ServerConn)
+		f := &remoteForward{conn: conn, ctx: ctx, bindAddr: payload.BindAddr, bindPort: payload.BindPort}
+		if !server.remoteForwards.add(id.ResourceName, f) {
+			return false, []byte(fmt.Sprintf("port %d is already forwarded", payload.BindPort))
+		}
+		go func() {
+			<-ctx.Done()
+			server.remoteForwards.remove(id.ResourceName, uint16(payload.BindPort), ctx)
+		}()
+
+		log.Info("Forwarding preview", "user", id.Username, "port", payload.BindPort, "public", f.Public(),
+			"url", server.previews.URL(id.ResourceName, uint16(payload.BindPort)))
+		return true, gossh.Marshal(&remoteForwardSuccess{payload.BindPort})
+	}
+}
+
+// Handles cancel-tcpip-forward requests.
+func cancelTCPIPForwardHandler(server *Server) ssh.RequestHandler {
+	return func(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
+		var payload remoteForwardRequest
+		if err := gossh.Unmarshal(req.Payload, &payload); err != nil {
+			return false, []byte(err.Error())
+		}
+		id, err := server.policy.Resolve(ctx.User())
+		if err != nil {
+			return false, []byte(err.Error())
+		}
+		server.remoteForwards.remove(id.ResourceName, uint16(payload.BindPort), ctx)
+		return true, nil
+	}
+}
+
+// streamConn adapts a stream to a net.Conn, for the HTTP transport.
+type streamConn struct {
+	forwardConn
+}
+
+func (c *streamConn) LocalAddr() net.Addr              { return streamAddr{} }
+func (c *streamConn) RemoteAddr() net.Addr             { return streamAddr{} }
+func (c *streamConn) SetDeadline(time.Time) error      { return nil }
+func (c *streamConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *streamConn) SetWriteDeadline(time.Time) error { return nil }
+
+type streamAddr struct{}
+
+func (streamAddr) Network() string { return "stream" }
+func (streamAddr) String() string  { return "stream" }
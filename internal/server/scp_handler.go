@@ -0,0 +1,222 @@
+package server
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/scp"
+
+	"github.com/ivanvc/boombox/internal/config"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// Handles scp uploads and downloads to the user's home, fetching or creating
+// the user's Pod if it's not running. Other sessions are passed to the next
+// handler.
+func scpMiddleware(server *Server, cfg *config.Config, client k8s.Backend, users *k8s.UserRegistry) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(sess ssh.Session) {
+			if _, _, active := sess.Pty(); active || !scp.GetInfo(sess.Command()).Ok {
+				next(sess)
+				return
+			}
+
+			common, err := newCommon(server, cfg, client, users, sess)
+			if err != nil {
+				log.Warn("Rejected session", "user", sess.User(), "error", err)
+				wish.Fatalln(sess, err)
+				return
+			}
+
+			server.RegisterSession(common.ResourceName, sess.Context().SessionID())
+			defer server.DeregisterSession(common.ResourceName, sess.Context().SessionID())
+			defer releasePod(server, client, common.ResourceName, sess.Context().SessionID())
+
+			// scp uses stderr to report errors, so the progress is not shown.
+			pod, err := provisionPod(common, io.Discard)
+			if err != nil {
+				log.Error("Error provisioning pod", "user", common.User, "error", err)
+				wish.Fatalln(sess, "Error:", err)
+				return
+			}
+
+			h := &scpHandler{files: client.NewPodFiles(pod, common.User)}
+			scp.Middleware(h, h)(next)(sess)
+		}
+	}
+}
+
+// scpHandler implements scp.Handler for the user's home in the Pod.
+type scpHandler struct {
+	files k8s.PodFiles
+
+	// The scp middleware always treats the upload target as a directory, so
+	// when it's not one (i.e., scp -r dir boombox:new-name), the uploaded
+	// paths are renamed from the first entry to the target.
+	renamedFrom, renamedTo string
+}
+
+// Maps the path from the scp command to the path in the Pod. Relative paths
+// are relative to the user's home, and paths can't go outside of it.
+func (h *scpHandler) path(name string) string {
+	home := h.files.Home()
+	name = path.Clean(strings.TrimPrefix(name, "~"))
+	if name == home || strings.HasPrefix(name, home+"/") {
+		return name
+	}
+	return homePath(home, name)
+}
+
+// Glob implements scp.CopyToClientHandler.
+func (h *scpHandler) Glob(_ ssh.Session, pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+	return h.files.Glob(h.path(pattern))
+}
+
+// WalkDir implements scp.CopyToClientHandler.
+func (h *scpHandler) WalkDir(_ ssh.Session, name string, fn fs.WalkDirFunc) error {
+	paths, infos, err := h.files.Walk(h.path(name))
+	if err != nil {
+		return fn(name, nil, err)
+	}
+	for i, p := range paths {
+		if err := fn(p, fs.FileInfoToDirEntry(infos[i]), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewDirEntry implements scp.CopyToClientHandler.
+func (h *scpHandler) NewDirEntry(_ ssh.Session, name string) (*scp.DirEntry, error) {
+	p := h.path(name)
+	info, err := h.files.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	return &scp.DirEntry{
+		Children: []scp.Entry{},
+		Name:     info.Name(),
+		Filepath: p,
+		Mode:     info.Mode(),
+		Mtime:    info.ModTime().Unix(),
+		Atime:    info.ModTime().Unix(),
+	}, nil
+}
+
+// NewFileEntry implements scp.CopyToClientHandler. The file is read from the
+// Pod when scp writes it to the client.
+func (h *scpHandler) NewFileEntry(_ ssh.Session, name string) (*scp.FileEntry, func() error, error) {
+	p := h.path(name)
+	info, err := h.files.Stat(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return nil, nil, &os.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+
+	r := &lazyReader{start: func(w io.Writer) error {
+		return h.files.ReadFile(p, w)
+	}}
+	return &scp.FileEntry{
+		Name:     info.Name(),
+		Filepath: p,
+		Mode:     info.Mode(),
+		Size:     info.Size(),
+		Mtime:    info.ModTime().Unix(),
+		Atime:    info.ModTime().Unix(),
+		Reader:   r,
+	}, r.Close, nil
+}
+
+// Mkdir implements scp.CopyFromClientHandler.
+func (h *scpHandler) Mkdir(_ ssh.Session, entry *scp.DirEntry) error {
+	p := h.uploadPath(entry.Filepath)
+	if info, err := h.files.Stat(p); err == nil && info.IsDir() {
+		return h.chtimes(p, entry.Mtime)
+	}
+	if err := h.files.Mkdir(p, entry.Mode); err != nil {
+		return err
+	}
+	return h.chtimes(p, entry.Mtime)
+}
+
+// Write implements scp.CopyFromClientHandler.
+func (h *scpHandler) Write(_ ssh.Session, entry *scp.FileEntry) (int64, error) {
+	p := h.uploadPath(entry.Filepath)
+	r := &countingReader{Reader: entry.Reader}
+	if err := h.files.WriteFile(p, r, entry.Mode); err != nil {
+		return r.n, err
+	}
+	return r.n, h.chtimes(p, entry.Mtime)
+}
+
+// Returns the path in the Pod for an uploaded entry. For the first entry, if
+// its parent (the target) is not a directory, the entry is renamed to the
+// target, and so are the entries that follow.
+func (h *scpHandler) uploadPath(name string) string {
+	p := h.path(name)
+	if h.renamedFrom == "" {
+		h.renamedFrom, h.renamedTo = p, p
+		if info, err := h.files.Stat(path.Dir(p)); err != nil || !info.IsDir() {
+			h.renamedTo = path.Dir(p)
+		}
+	}
+	if p == h.renamedFrom || strings.HasPrefix(p, h.renamedFrom+"/") {
+		return h.renamedTo + strings.TrimPrefix(p, h.renamedFrom)
+	}
+	return p
+}
+
+func (h *scpHandler) chtimes(name string, mtime int64) error {
+	if mtime == 0 {
+		return nil
+	}
+	return h.files.Chtimes(name, time.Unix(mtime, 0))
+}
+
+// lazyReader reads from start, which runs when the first byte is read.
+type lazyReader struct {
+	start func(io.Writer) error
+	pr    *io.PipeReader
+}
+
+func (r *lazyReader) Read(p []byte) (int, error) {
+	if r.pr == nil {
+		var pw *io.PipeWriter
+		r.pr, pw = io.Pipe()
+		go func() {
+			pw.CloseWithError(r.start(pw))
+		}()
+	}
+	return r.pr.Read(p)
+}
+
+func (r *lazyReader) Close() error {
+	if r.pr == nil {
+		return nil
+	}
+	return r.pr.Close()
+}
+
+// countingReader counts the bytes read.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
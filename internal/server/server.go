@@ -2,7 +2,9 @@ package server
 
 import (
 	"context"
+	"net/http"
 	"sync"
+	"sync/atomic"
 
 	"github.com/charmbracelet/log"
 	"github.com/charmbracelet/ssh"
@@ -11,60 +13,117 @@ import (
 	"github.com/charmbracelet/wish/logging"
 	"github.com/muesli/termenv"
 
+	"github.com/ivanvc/boombox/internal/auth"
 	"github.com/ivanvc/boombox/internal/config"
+	"github.com/ivanvc/boombox/internal/identity"
+	"github.com/ivanvc/boombox/internal/preview"
 	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+	"github.com/ivanvc/boombox/internal/watch"
 )
 
 // Server holds the boombox server.
 type Server struct {
 	config *config.Config
+	client k8s.Backend
+	policy *identity.Policy
+	users  *k8s.UserRegistry
 	*ssh.Server
 	activeSessions sync.WaitGroup
+	replica        string
+	sessionsMu     sync.Mutex
+	// sessionPods counts the active sessions by the user's resource name, and
+	// session ID. A connection can have more than one session.
+	sessionPods map[string]map[string]int
+	stopLeases  context.CancelFunc
 
-	shuttingDown bool
+	previews       *preview.Proxy
+	remoteForwards remoteForwards
+	watches        *watch.Hub
+
+	shuttingDown atomic.Bool
 }
 
-// New returns a new *Server, configured to run boombox.
-func New(cfg *config.Config, client *k8s.Client) *Server {
-	s := &Server{config: cfg}
-	var err error
-	s.Server, err = wish.NewServer(
+// New returns a new *Server, configured to run boombox. If authenticator is
+// nil, any user is allowed to log in. If users is not nil, the Pod settings
+// are taken from the user's BoomboxUser.
+func New(cfg *config.Config, client k8s.Backend, authenticator auth.Authenticator, users *k8s.UserRegistry) *Server {
+	s := &Server{
+		config:         cfg,
+		client:         client,
+		replica:        replicaName(),
+		sessionPods:    make(map[string]map[string]int),
+		policy:         identity.NewPolicy(cfg.DeniedUsernames),
+		users:          users,
+		remoteForwards: remoteForwards{forwards: make(map[remoteForwardKey]*remoteForward)},
+		watches:        watch.NewHub(),
+	}
+	if cfg.PreviewURL != "" {
+		var err error
+		if s.previews, err = preview.New(cfg.PreviewURL, cfg.PreviewSecret, s.resolvePreview(client), s.authorizeViewer, s.authorizePreview); err != nil {
+			log.Error("could not start previews", "error", err)
+			return nil
+		}
+		if cfg.PreviewSecret == "" {
+			log.Warn("preview-secret is not set, preview logins only work in this replica until it restarts. Set it when running more than one replica")
+		}
+	}
+	opts := []ssh.Option{
 		wish.WithAddress(cfg.Listen),
 		wish.WithHostKeyPath(cfg.HostKeyPath),
 		wish.WithMiddleware(
-			bm.MiddlewareWithProgramHandler(sessionHandler(s, cfg, client), termenv.ANSI256),
-			logging.Middleware(),
+			exitCodeMiddleware(),
+			bm.MiddlewareWithProgramHandler(sessionHandler(s, cfg, client, users), termenv.ANSI256),
+			watchMiddleware(s, cfg, users),
+			commandMiddleware(s, cfg, client, users),
+			scpMiddleware(s, cfg, client, users),
+			// The standard logger of log.Default() shares its buffer, but not
+			// its lock, so the connections are logged with a new logger.
+			logging.MiddlewareWithLogger(log.With().StandardLog()),
 		),
-	)
+	}
+	opts = append(opts, func(srv *ssh.Server) error {
+		srv.SubsystemHandlers = map[string]ssh.SubsystemHandler{
+			"sftp":          sftpHandler(s, cfg, client, users),
+			"preview-login": previewLoginHandler(s),
+		}
+		srv.RequestHandlers = map[string]ssh.RequestHandler{
+			"tcpip-forward":        tcpipForwardHandler(s),
+			"cancel-tcpip-forward": cancelTCPIPForwardHandler(s),
+		}
+		srv.ChannelHandlers = map[string]ssh.ChannelHandler{
+			"session":      ssh.DefaultSessionHandler,
+			"direct-tcpip": directTCPIPHandler(s, cfg, client, users),
+		}
+		return nil
+	})
+	if authenticator != nil {
+		opts = append(opts, wish.WithPublicKeyAuth(authHandler(s.policy, authenticator)))
+	}
+
+	var err error
+	s.Server, err = wish.NewServer(opts...)
 	if err != nil {
 		log.Error("could not start server", "error", err)
 		return nil
 	}
 
+	var ctx context.Context
+	ctx, s.stopLeases = context.WithCancel(context.Background())
+	go s.runSessionLeases(ctx)
+
 	return s
 }
 
-// Shutdowns the server by closing all active connections.
-func (s *Server) Shutdown(ctx context.Context) error {
-	s.shuttingDown = true
-	if err := s.Close(); err != nil {
-		return err
+// Returns the HTTP handler that serves the previews, or nil if they are
+// disabled.
+func (s *Server) Previews() http.Handler {
+	if s.previews == nil {
+		return nil
 	}
-	s.activeSessions.Wait()
-	return s.Server.Shutdown(ctx)
+	return s.previews
 }
 
 // Returns true if the server is shutting down.
 func (s *Server) IsShuttingDown() bool {
-	return s.shuttingDown
-}
-
-// Registers a new session.
-func (s *Server) RegisterSession() {
-	s.activeSessions.Add(1)
-}
-
-// Deregisters a session.
-func (s *Server) DeregisterSession() {
-	s.activeSessions.Done()
+	return s.shuttingDown.Load()
 }
@@ -0,0 +1,578 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/ivanvc/boombox/internal/config"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+	"github.com/ivanvc/boombox/internal/services/kubernetes/fake"
+)
+
+// How long to wait for the screen, or the backend, to reach a state.
+const waitTimeout = 10 * time.Second
+
+// testServer is a boombox server on a random port, with a fake backend.
+type testServer struct {
+	*Server
+	t       *testing.T
+	backend *fake.Backend
+	addr    string
+
+	shutdownOnce sync.Once
+}
+
+func newTestServer(t *testing.T, objects ...runtime.Object) *testServer {
+	t.Helper()
+	return newTestServerWithConfig(t, nil, objects...)
+}
+
+// Returns a new testServer, with the config changed by configure, if not nil.
+func newTestServerWithConfig(t *testing.T, configure func(*config.Config), objects ...runtime.Object) *testServer {
+	t.Helper()
+	backend := fake.New(objects...)
+	backend.Exec.Shell = testShell
+	cfg := &config.Config{
+		HostKeyPath:          filepath.Join(t.TempDir(), "host_key"),
+		DeniedUsernames:      []string{"root"},
+		ContainerImage:       "ubuntu",
+		PVCSize:              "1Gi",
+		ShutdownGracePeriod:  time.Second,
+		DeletePodsOnShutdown: true,
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	s := New(cfg, backend, nil, nil)
+	if s == nil {
+		t.Fatal("could not create the server")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+
+	ts := &testServer{Server: s, t: t, backend: backend, addr: l.Addr().String()}
+	t.Cleanup(func() { ts.shutdown() })
+	return ts
+}
+
+// Shuts the server down, once.
+func (ts *testServer) shutdown() {
+	ts.shutdownOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+		defer cancel()
+		if err := ts.Shutdown(ctx); err != nil {
+			ts.t.Errorf("error shutting down: %v", err)
+		}
+	})
+}
+
+// Waits until cond is true.
+func (ts *testServer) waitFor(what string, cond func() bool) {
+	ts.t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			ts.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (ts *testServer) pod(name string) *corev1.Pod {
+	ts.t.Helper()
+	pod, err := ts.backend.GetPod(name)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return pod
+}
+
+func (ts *testServer) pvc(name string) *corev1.PersistentVolumeClaim {
+	ts.t.Helper()
+	pvc, err := ts.backend.GetPVC(name)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return pvc
+}
+
+// Returns the commands that contain substring, run by the backend.
+func (ts *testServer) commands(substring string) []fake.Command {
+	var commands []fake.Command
+	for _, cmd := range ts.backend.Exec.Commands() {
+		if strings.Contains(cmd.Line(), substring) {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+// testClient is a user connected with a PTY.
+type testClient struct {
+	t       *testing.T
+	client  *gossh.Client
+	session *gossh.Session
+	stdin   io.WriteCloser
+	screen  *screen
+	done    chan struct{}
+	err     error
+}
+
+// Connects as the user. The connection is closed at the end of the test.
+func (ts *testServer) dial(user string) *gossh.Client {
+	ts.t.Helper()
+	client, err := gossh.Dial("tcp", ts.addr, &gossh.ClientConfig{
+		User:            user,
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	ts.t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Logs in as the user, with an 80x24 terminal.
+func (ts *testServer) login(user string) *testClient {
+	ts.t.Helper()
+	client := ts.dial(user)
+	session, err := client.NewSession()
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	c := &testClient{t: ts.t, client: client, session: session, screen: &screen{}, done: make(chan struct{})}
+	session.Stdout, session.Stderr = c.screen, c.screen
+	if c.stdin, err = session.StdinPipe(); err != nil {
+		ts.t.Fatal(err)
+	}
+	if err := session.RequestPty("xterm-256color", 24, 80, gossh.TerminalModes{}); err != nil {
+		ts.t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		ts.t.Fatal(err)
+	}
+	go func() {
+		defer close(c.done)
+		c.err = session.Wait()
+	}()
+	return c
+}
+
+// Sends the keys, as a single write.
+func (c *testClient) press(keys string) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.stdin, keys); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Resizes the client's terminal, and waits for the UI to redraw it. While
+// attached to a shell, the UI gets the new size once the shell exits.
+func (c *testClient) resize(width, height int) {
+	c.t.Helper()
+	before := c.screen.len()
+	if err := c.session.WindowChange(height, width); err != nil {
+		c.t.Fatal(err)
+	}
+	deadline := time.Now().Add(waitTimeout)
+	for c.screen.len() == before {
+		if time.Now().After(deadline) {
+			c.t.Fatal("timed out waiting for the UI to redraw")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Waits for the text to be rendered on the screen.
+func (c *testClient) waitForScreen(text string) {
+	c.t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !strings.Contains(c.screen.text(), text) {
+		if time.Now().After(deadline) {
+			c.t.Fatalf("timed out waiting for %q on the screen:\n%s", text, c.screen.text())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Waits for the server to end the session, and returns its exit status. As
+// ssh does, it closes the connection afterwards.
+func (c *testClient) wait() int {
+	c.t.Helper()
+	select {
+	case <-c.done:
+	case <-time.After(waitTimeout):
+		c.t.Fatalf("timed out waiting for the session to end:\n%s", c.screen.text())
+	}
+	c.client.Close()
+	var exitErr *gossh.ExitError
+	if errors.As(c.err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+	if c.err != nil {
+		c.t.Fatalf("session ended with %v", c.err)
+	}
+	return 0
+}
+
+// Closes the connection without ending the session, like a client that's
+// gone.
+func (c *testClient) disconnect() {
+	c.t.Helper()
+	c.client.Close()
+	select {
+	case <-c.done:
+	case <-time.After(waitTimeout):
+		c.t.Fatal("timed out waiting for the connection to close")
+	}
+}
+
+// Exits the user's shell with the exit status, and the completed screen.
+func (c *testClient) exitShell(code int) {
+	c.t.Helper()
+	// As the UI says, the first keys after attaching may be lost. Press enter
+	// until the shell shows a new prompt.
+	prompts := strings.Count(c.screen.text(), prompt)
+	for deadline := time.Now().Add(waitTimeout); strings.Count(c.screen.text(), prompt) == prompts; {
+		if time.Now().After(deadline) {
+			c.t.Fatalf("timed out waiting for the shell to read the input:\n%s", c.screen.text())
+		}
+		c.press("\r")
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.press(fmt.Sprintf("exit %d\r", code))
+	c.waitForScreen("Shell exited")
+	c.quit()
+}
+
+// Presses q until the session ends. The UI may lose the first key after the
+// shell exits.
+func (c *testClient) quit() {
+	for {
+		io.WriteString(c.stdin, "q")
+		select {
+		case <-c.done:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// screen holds the output sent to the client.
+type screen struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+var escapeSequence = regexp.MustCompile(`\x1b(\[[0-9;?]*[a-zA-Z]|\][^\x07]*\x07|[()][0-9A-Z])`)
+
+func (s *screen) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Len()
+}
+
+// Returns the output without the escape sequences.
+func (s *screen) text() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return escapeSequence.ReplaceAllString(s.buf.String(), "")
+}
+
+const prompt = "alice@box:~$ "
+
+// testShell is the user's shell in the fake backend. It shows a prompt, and
+// runs until the exit command, or until stdin is closed.
+func testShell(_ context.Context, streams remotecommand.StreamOptions) error {
+	io.WriteString(streams.Stdout, prompt)
+	scanner := bufio.NewScanner(streams.Stdin)
+	scanner.Split(scanLines)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			io.WriteString(streams.Stdout, "\r\n"+prompt)
+			continue
+		}
+		if fields[0] == "exit" {
+			if len(fields) > 1 && fields[1] != "0" {
+				code, _ := strconv.Atoi(fields[1])
+				return fake.ExitError(code)
+			}
+			return nil
+		}
+		fmt.Fprintf(streams.Stdout, "\r\n%s: command not found\r\n%s", fields[0], prompt)
+	}
+	return nil
+}
+
+// Splits the terminal input in lines, ended by a carriage return.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\r'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func TestFirstLoginOverSSH(t *testing.T) {
+	ts := newTestServer(t)
+	c := ts.login("alice")
+
+	c.waitForScreen(prompt)
+	if pvc := ts.pvc("alice"); pvc == nil || pvc.Spec.Resources.Requests.Storage().String() != "1Gi" {
+		t.Errorf("got PVC %v, want a 1Gi PVC", pvc)
+	}
+	pod := ts.pod("alice")
+	if pod == nil {
+		t.Fatal("the Pod was not created")
+	}
+	if image := pod.Spec.InitContainers[0].Image; image != "ivan/boombox-init:ubuntu" {
+		t.Errorf("got init container image %q, want the initial one", image)
+	}
+
+	c.exitShell(3)
+	if code := c.wait(); code != 3 {
+		t.Errorf("got exit status %d, want 3", code)
+	}
+	ts.waitFor("the Pod to be deleted", func() bool { return ts.pod("alice") == nil })
+	if ts.pvc("alice") == nil {
+		t.Error("the PVC was deleted, want it kept")
+	}
+}
+
+func TestReturningUserOverSSH(t *testing.T) {
+	ts := newTestServer(t, fake.BoundPVC("alice"))
+	c := ts.login("alice")
+
+	c.waitForScreen(prompt)
+	pod := ts.pod("alice")
+	if pod == nil {
+		t.Fatal("the Pod was not created")
+	}
+	if image := pod.Spec.InitContainers[0].Image; image != "ivan/boombox-box:ubuntu" {
+		t.Errorf("got init container image %q, want the returning user's one", image)
+	}
+
+	c.exitShell(0)
+	if code := c.wait(); code != 0 {
+		t.Errorf("got exit status %d, want 0", code)
+	}
+}
+
+func TestPodAlreadyRunningOverSSH(t *testing.T) {
+	ts := newTestServer(t, fake.BoundPVC("alice"), fake.RunningPod("alice", "alice"))
+	ts.backend.Exec.Handle("ps -e", fake.Output("  42  42  42  42  600 pts/1 -bash\n\n/dev/pts/1 1700000000\n", 0))
+	c := ts.login("alice")
+
+	c.waitForScreen("You have running sessions")
+	c.waitForScreen("42       pts/1")
+	if len(ts.commands("su - alice")) != 0 {
+		t.Fatal("got a shell before picking a session")
+	}
+	if live := k8s.LiveSessionLeases(ts.pod("alice"), sessionLeaseTTL); live != 1 {
+		t.Errorf("got %d session leases, want 1", live)
+	}
+
+	c.resize(120, 40)
+	c.press("n")
+	c.waitForScreen(prompt)
+	if sizes := ts.backend.Exec.Sizes(); len(sizes) == 0 || sizes[0] != (remotecommand.TerminalSize{Width: 120, Height: 40}) {
+		t.Errorf("got terminal sizes %v, want 120x40", sizes)
+	}
+	c.exitShell(0)
+	c.wait()
+
+	ts.waitFor("the Pod to be deleted", func() bool { return ts.pod("alice") == nil })
+}
+
+func TestDetachedMultiplexerSessionKeepsPod(t *testing.T) {
+	ts := newTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.SessionMultiplexer = true
+	}, fake.BoundPVC("alice"), fake.RunningPod("alice", "alice"))
+	c := ts.login("alice")
+	c.waitForScreen(prompt)
+	if len(ts.commands("tmux new-session")) == 0 {
+		t.Fatalf("got commands %v, want a new tmux session", ts.backend.Exec.Commands())
+	}
+
+	// The client disconnects, and the tmux session is left detached.
+	ts.backend.Exec.Handle("tmux list-sessions", fake.Output("0\t1700000000\t1700000000\t0\t/dev/pts/1\tbash\n", 0))
+	listed := len(ts.commands("tmux list-sessions"))
+	c.disconnect()
+	ts.waitFor("the sessions to be listed", func() bool { return len(ts.commands("tmux list-sessions")) > listed })
+	pod := ts.pod("alice")
+	if pod == nil {
+		t.Fatal("the Pod was deleted with a detached tmux session")
+	}
+	if live := k8s.LiveSessionLeases(pod, sessionLeaseTTL); live != 0 {
+		t.Errorf("got %d session leases, want 0", live)
+	}
+
+	// Once the tmux session ends, the Pod is reaped.
+	ts.backend.Exec.Handle("tmux list-sessions", fake.Output("", 0))
+	ts.reapPod(pod)
+	if ts.pod("alice") != nil {
+		t.Error("the Pod was not deleted without tmux sessions")
+	}
+}
+
+func TestIdleMultiplexerSessionIsKilled(t *testing.T) {
+	ts := newTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.SessionMultiplexer = true
+		cfg.IdleTimeout = 2 * time.Second
+	}, fake.BoundPVC("alice"), fake.RunningPod("alice", "alice"))
+	c := ts.login("alice")
+	c.waitForScreen(prompt)
+	if len(ts.commands("tmux new-session -s '0'")) == 0 {
+		t.Fatalf("got commands %v, want a new tmux session named 0", ts.backend.Exec.Commands())
+	}
+
+	ts.backend.Exec.Handle("tmux list-sessions", fake.Output("0\t1700000000\t1700000000\t1\t/dev/pts/1\tbash\n", 0))
+	ts.backend.Exec.Handle("tmux kill-session", func(context.Context, remotecommand.StreamOptions) error {
+		ts.backend.Exec.Handle("tmux list-sessions", fake.Output("", 0))
+		return nil
+	})
+	select {
+	case <-c.done:
+	case <-time.After(waitTimeout):
+		t.Fatal("the idle session is still open")
+	}
+	c.waitForScreen("Disconnecting, the session was idle for 2s.")
+	if len(ts.commands("tmux kill-session -t '=0'")) == 0 {
+		t.Errorf("got commands %v, want the tmux session killed", ts.backend.Exec.Commands())
+	}
+	ts.waitFor("the Pod to be deleted", func() bool { return ts.pod("alice") == nil })
+}
+
+func TestWatchRedrawsSession(t *testing.T) {
+	ts := newTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.Watchers = []string{"bob"}
+	}, fake.BoundPVC("alice"))
+	alice := ts.login("alice")
+	alice.waitForScreen(prompt)
+	sizes := len(ts.backend.Exec.Sizes())
+
+	bob := ts.login("bob+watch:alice")
+	alice.waitForScreen("bob started watching your session")
+	ts.waitFor("the session to be redrawn", func() bool { return len(ts.backend.Exec.Sizes()) >= sizes+2 })
+	want := []remotecommand.TerminalSize{{Width: 80, Height: 23}, {Width: 80, Height: 24}}
+	if got := ts.backend.Exec.Sizes()[sizes:]; got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got terminal sizes %v, want %v", got, want)
+	}
+
+	bob.press("q")
+	bob.wait()
+	alice.exitShell(0)
+	alice.wait()
+}
+
+func TestErrorCreatingPodOverSSH(t *testing.T) {
+	ts := newTestServer(t, fake.BoundPVC("alice"))
+	ts.backend.Clientset.PrependReactor("create", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("exceeded quota")
+	})
+	c := ts.login("alice")
+
+	c.waitForScreen("ERROR")
+	c.waitForScreen("exceeded quota")
+	c.quit()
+	if code := c.wait(); code != 1 {
+		t.Errorf("got exit status %d, want 1", code)
+	}
+	if len(ts.backend.Exec.Commands()) != 0 {
+		t.Errorf("got commands %v, want none", ts.backend.Exec.Commands())
+	}
+}
+
+func TestCommandStopsWhenClientDisconnects(t *testing.T) {
+	ts := newTestServer(t, fake.BoundPVC("alice"), fake.RunningPod("alice", "alice"))
+	stopped := make(chan struct{})
+	ts.backend.Exec.Handle("sleep 100", func(ctx context.Context, _ remotecommand.StreamOptions) error {
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err()
+	})
+	client := ts.dial("alice")
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Start("sleep 100"); err != nil {
+		t.Fatal(err)
+	}
+	ts.waitFor("the command", func() bool { return len(ts.commands("sleep 100")) > 0 })
+
+	client.Close()
+	select {
+	case <-stopped:
+	case <-time.After(waitTimeout):
+		t.Fatal("the command is still running after the client disconnected")
+	}
+}
+
+func TestDeniedUser(t *testing.T) {
+	ts := newTestServer(t)
+	c := ts.login("root")
+
+	if code := c.wait(); code != 1 {
+		t.Errorf("got exit status %d, want 1", code)
+	}
+	if !strings.Contains(c.screen.text(), `username "root" is not allowed`) {
+		t.Errorf("got screen %q, want the rejection", c.screen.text())
+	}
+	if actions := ts.backend.Clientset.Actions(); len(actions) != 0 {
+		t.Errorf("got Kubernetes actions %v, want none", actions)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ts := newTestServer(t, fake.BoundPVC("alice"), fake.RunningPod("alice", "alice"))
+	c := ts.login("alice")
+	c.waitForScreen(prompt)
+
+	ts.shutdown()
+
+	if walls := ts.commands("Boombox is shutting down in 1s"); len(walls) == 0 {
+		t.Errorf("got commands %v, want a wall", ts.backend.Exec.Commands())
+	}
+	select {
+	case <-c.done:
+	case <-time.After(waitTimeout):
+		t.Fatal("the session is still open")
+	}
+	if ts.pod("alice") != nil {
+		t.Error("the Pod was not deleted")
+	}
+	if _, err := net.DialTimeout("tcp", ts.addr, time.Second); err == nil {
+		t.Error("the server accepted a connection after shutting down")
+	}
+}
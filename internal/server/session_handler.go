@@ -1,37 +1,42 @@
 package server
 
 import (
+	"fmt"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/log"
 	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
 	bm "github.com/charmbracelet/wish/bubbletea"
 
+	"github.com/ivanvc/boombox/internal/auth"
 	"github.com/ivanvc/boombox/internal/config"
+	"github.com/ivanvc/boombox/internal/identity"
 	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
 	"github.com/ivanvc/boombox/internal/ui"
 	"github.com/ivanvc/boombox/internal/ui/actions"
 	"github.com/ivanvc/boombox/internal/ui/common"
 )
 
-func sessionHandler(server *Server, cfg *config.Config, client *k8s.Client) bm.ProgramHandler {
+// The context key that holds the UI session's Common.
+var contextKeyCommon = &struct{ name string }{"common"}
+
+func sessionHandler(server *Server, cfg *config.Config, client k8s.Backend, users *k8s.UserRegistry) bm.ProgramHandler {
 	return func(sess ssh.Session) *tea.Program {
-		pty, _, active := sess.Pty()
-		if !active {
+		if _, _, active := sess.Pty(); !active {
 			log.Error("No active terminal", "session", sess)
 			return nil
 		}
 
-		server.RegisterSession()
-		common := &common.Common{
-			Session: sess,
-			User:    sess.User(),
-			Width:   pty.Window.Width,
-			Height:  pty.Window.Height,
-			Client:  client,
-			Config:  cfg,
-			Actions: actions.New(client),
+		common, err := newCommon(server, cfg, client, users, sess)
+		if err != nil {
+			log.Warn("Rejected session", "user", sess.User(), "error", err)
+			wish.Fatalln(sess, err)
+			return nil
 		}
 
+		sess.Context().SetValue(contextKeyCommon, common)
+		server.RegisterSession(common.ResourceName, sess.Context().SessionID())
 		ctx := log.WithContext(sess.Context(), log.Default())
 		p := tea.NewProgram(ui.New(common),
 			tea.WithInput(sess),
@@ -41,22 +46,100 @@ func sessionHandler(server *Server, cfg *config.Config, client *k8s.Client) bm.P
 		)
 
 		go func() {
-			defer server.DeregisterSession()
+			defer server.DeregisterSession(common.ResourceName, sess.Context().SessionID())
 			<-ctx.Done()
-			pod, err := client.GetPod(sess.User())
-			if pod == nil || err != nil {
-				return
-			}
-			if server.IsShuttingDown() {
-				client.DeletePod(pod)
-			}
-			count, _ := client.GetActivePTYs(pod)
-			log.Debug("Active PTYs", "pod", pod.Name, "count", count)
-			if count == 1 {
-				client.DeletePod(pod)
-			}
+			releasePod(server, client, common.ResourceName, sess.Context().SessionID())
 		}()
 
 		return p
 	}
 }
+
+// Sends the exit code of the UI session to the client. It's the handler next to
+// the Bubble Tea middleware, so it runs once the program finishes.
+func exitCodeMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(sess ssh.Session) {
+			if cmn, ok := sess.Context().Value(contextKeyCommon).(*common.Common); ok {
+				sess.Exit(cmn.ExitCode)
+			}
+			next(sess)
+		}
+	}
+}
+
+// Returns the Common for the session, or an error if the user is not allowed.
+func newCommon(server *Server, cfg *config.Config, client k8s.Backend, users *k8s.UserRegistry, sess ssh.Session) (*common.Common, error) {
+	if server.IsShuttingDown() {
+		return nil, fmt.Errorf("boombox is shutting down, try again in a moment")
+	}
+	id, account, err := resolveUser(server, users, sess.User())
+	if err != nil {
+		return nil, err
+	}
+	if id.Selector.Kind == identity.SelectorResume && !cfg.SessionMultiplexer {
+		return nil, fmt.Errorf("resumable sessions are disabled")
+	}
+	if id.Selector.Kind == identity.SelectorWatch {
+		return nil, fmt.Errorf("watching a session requires a terminal")
+	}
+
+	pty, _, _ := sess.Pty()
+	return &common.Common{
+		Session:      sess,
+		User:         id.Username,
+		ResourceName: id.ResourceName,
+		Account:      account,
+		Extensions:   auth.Extensions(sess.Context()),
+		Selector:     id.Selector,
+		Width:        pty.Window.Width,
+		Height:       pty.Window.Height,
+		Client:       client,
+		Config:       cfg,
+		Actions:      actions.New(sess.Context(), client, server.replica+"/"+sess.Context().SessionID()),
+		Watches:      server.watches,
+	}, nil
+}
+
+// Returns the identity for the username, and its BoomboxUser if users is not
+// nil.
+func resolveUser(server *Server, users *k8s.UserRegistry, username string) (*identity.Identity, *k8s.BoomboxUser, error) {
+	id, err := server.policy.Resolve(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if users == nil {
+		return id, nil, nil
+	}
+
+	account, err := users.Get(id.ResourceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if account == nil {
+		return nil, nil, fmt.Errorf("no BoomboxUser for user %q", id.Username)
+	}
+	return id, account, nil
+}
+
+// Releases the session's lease on the user's Pod, and deletes the Pod if no
+// other session holds a lease. When the server is shutting down, and
+// delete-pods-on-shutdown is not set, the lease is kept until it expires, so
+// the user can log in again.
+func releasePod(server *Server, client k8s.Backend, name, id string) {
+	if server.IsShuttingDown() && !server.config.DeletePodsOnShutdown {
+		return
+	}
+	if server.sessionCount(name, id) > 1 {
+		return
+	}
+	if err := client.ReleaseSessionLease(name, id); err != nil {
+		log.Error("Error releasing session lease", "pod", name, "error", err)
+		return
+	}
+	pod, err := client.GetPod(name)
+	if pod == nil || err != nil {
+		return
+	}
+	server.reapPod(pod)
+}
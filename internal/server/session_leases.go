@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/log"
+	corev1 "k8s.io/api/core/v1"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+const (
+	// How often the replica renews the leases of its sessions.
+	leaseRenewInterval = 30 * time.Second
+	// How long a lease is valid without being renewed.
+	sessionLeaseTTL = 2 * time.Minute
+	// How often the Pods without live leases are deleted.
+	reconcileInterval = time.Minute
+)
+
+// Returns the name that identifies this replica in the leases, the Pod name
+// when running in Kubernetes.
+func replicaName() string {
+	if name, err := os.Hostname(); err == nil {
+		return name
+	}
+	return "boombox"
+}
+
+// Registers a new session of the user with the resource name, and acquires
+// its lease on the user's Pod, if it exists. Otherwise, the lease is acquired
+// with the next renewal.
+func (s *Server) RegisterSession(name, id string) {
+	s.activeSessions.Add(1)
+	s.sessionsMu.Lock()
+	if s.sessionPods[name] == nil {
+		s.sessionPods[name] = make(map[string]int)
+	}
+	s.sessionPods[name][id]++
+	s.sessionsMu.Unlock()
+
+	if err := s.client.RenewSessionLeases(name, s.replica, []string{id}); err != nil {
+		log.Error("Error acquiring session lease", "pod", name, "error", err)
+	}
+}
+
+// Deregisters a session of the user with the resource name.
+func (s *Server) DeregisterSession(name, id string) {
+	s.sessionsMu.Lock()
+	if s.sessionPods[name][id]--; s.sessionPods[name][id] <= 0 {
+		delete(s.sessionPods[name], id)
+	}
+	if len(s.sessionPods[name]) == 0 {
+		delete(s.sessionPods, name)
+	}
+	s.sessionsMu.Unlock()
+	s.activeSessions.Done()
+}
+
+// Returns the number of sessions with the ID for the user with the resource
+// name.
+func (s *Server) sessionCount(name, id string) int {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	return s.sessionPods[name][id]
+}
+
+// Returns the resource names of the users with active sessions, and their
+// session IDs.
+func (s *Server) activeSessionIDs() map[string][]string {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	sessions := make(map[string][]string, len(s.sessionPods))
+	for name, ids := range s.sessionPods {
+		for id := range ids {
+			sessions[name] = append(sessions[name], id)
+		}
+	}
+	return sessions
+}
+
+// Returns the resource names of the users with active sessions.
+func (s *Server) activePods() []string {
+	var names []string
+	for name := range s.activeSessionIDs() {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Renews the leases of the replica's sessions, and deletes the Pods without
+// live leases, until ctx is done.
+func (s *Server) runSessionLeases(ctx context.Context) {
+	renew := time.NewTicker(leaseRenewInterval)
+	defer renew.Stop()
+	reconcile := time.NewTicker(reconcileInterval)
+	defer reconcile.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-renew.C:
+			s.renewSessionLeases()
+		case <-reconcile.C:
+			s.reconcilePods()
+		}
+	}
+}
+
+func (s *Server) renewSessionLeases() {
+	for name, ids := range s.activeSessionIDs() {
+		if err := s.client.RenewSessionLeases(name, s.replica, ids); err != nil {
+			log.Error("Error renewing session leases", "pod", name, "error", err)
+		}
+	}
+}
+
+// Deletes the Pods created by boombox without live leases. Pods younger than
+// the lease TTL are skipped, as their sessions may not have a lease yet.
+func (s *Server) reconcilePods() {
+	pods, err := s.client.ListManagedPods()
+	if err != nil {
+		log.Error("Error listing pods", "error", err)
+		return
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp != nil || time.Since(pod.CreationTimestamp.Time) < sessionLeaseTTL {
+			continue
+		}
+		s.reapPod(pod)
+	}
+}
+
+// Deletes the Pod if no session holds a live lease on it and, with the
+// multiplexer, if there are no tmux sessions left in it. The Pod is not
+// deleted if it changed since it was fetched (i.e., a session acquired a
+// lease).
+func (s *Server) reapPod(pod *corev1.Pod) {
+	if live := k8s.LiveSessionLeases(pod, sessionLeaseTTL); live > 0 {
+		log.Debug("Live session leases", "pod", pod.Name, "count", live)
+		return
+	}
+	if s.config.SessionMultiplexer && pod.Status.Phase == corev1.PodRunning {
+		sessions, err := s.client.ListSessions(pod, pod.Annotations[k8s.UsernameAnnotation], true)
+		if err != nil {
+			log.Error("Error listing sessions", "pod", pod.Name, "error", err)
+			return
+		}
+		if len(sessions) > 0 {
+			log.Debug("Keeping pod with multiplexer sessions", "pod", pod.Name, "count", len(sessions))
+			return
+		}
+	}
+	deleted, err := s.client.DeletePodIfUnchanged(pod)
+	if err != nil {
+		log.Error("Error deleting pod", "pod", pod.Name, "error", err)
+		return
+	}
+	if deleted {
+		log.Info("Deleted pod without sessions", "pod", pod.Name)
+	}
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/pkg/sftp"
+
+	"github.com/ivanvc/boombox/internal/config"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// The maximum size of the files transferred over SFTP, as they're buffered in
+// a temporary file in the server.
+const maxSFTPFileSize = 1 << 30
+
+var errSFTPFileTooLarge = fmt.Errorf("the file is larger than the %d bytes limit", maxSFTPFileSize)
+
+// Serves the user's home over SFTP, fetching or creating the user's Pod if
+// it's not running. The home is the root for the client, so paths can't go
+// outside of it, and all the operations run as the user in the Pod.
+func sftpHandler(server *Server, cfg *config.Config, client k8s.Backend, users *k8s.UserRegistry) ssh.SubsystemHandler {
+	return func(sess ssh.Session) {
+		common, err := newCommon(server, cfg, client, users, sess)
+		if err != nil {
+			log.Warn("Rejected session", "user", sess.User(), "error", err)
+			wish.Fatalln(sess, err)
+			return
+		}
+
+		server.RegisterSession(common.ResourceName, sess.Context().SessionID())
+		defer server.DeregisterSession(common.ResourceName, sess.Context().SessionID())
+		defer releasePod(server, client, common.ResourceName, sess.Context().SessionID())
+
+		pod, err := provisionPod(common, sess.Stderr())
+		if err != nil {
+			log.Error("Error provisioning pod", "user", common.User, "error", err)
+			wish.Fatalln(sess, "Error:", err)
+			return
+		}
+
+		h := &homeHandler{files: client.NewPodFiles(pod, common.User)}
+		rs := sftp.NewRequestServer(sess, sftp.Handlers{
+			FileGet:  h,
+			FilePut:  h,
+			FileCmd:  h,
+			FileList: h,
+		})
+		if err := rs.Serve(); err != nil && !errors.Is(err, io.EOF) {
+			log.Error("Error serving SFTP", "user", common.User, "error", err)
+		}
+	}
+}
+
+// homeHandler implements the sftp.Handlers for the user's home in the Pod.
+type homeHandler struct {
+	files k8s.PodFiles
+}
+
+// Maps the path the client sees to the path in the Pod.
+func (h *homeHandler) path(name string) string {
+	return homePath(h.files.Home(), name)
+}
+
+// Fileread implements sftp.FileReader. The file is copied to a local
+// temporary file, as the reads can happen at any offset.
+func (h *homeHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	f, err := os.CreateTemp("", "boombox-sftp-")
+	if err != nil {
+		return nil, err
+	}
+	tmp := &tempFile{f}
+	if err := h.files.ReadFile(h.path(r.Filepath), &limitedWriter{f, maxSFTPFileSize}); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// Filewrite implements sftp.FileWriter. The writes go to a local temporary
+// file, which is copied to the Pod when the client closes the file. Unless
+// the file is truncated, it starts with the existing content, as the client
+// can write at any offset, e.g., to resume an upload.
+func (h *homeHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	f, err := os.CreateTemp("", "boombox-sftp-")
+	if err != nil {
+		return nil, err
+	}
+	tmp := &tempFile{f}
+
+	name := h.path(r.Filepath)
+	if flags := r.Pflags(); !flags.Trunc {
+		err := h.files.ReadFile(name, &limitedWriter{f, maxSFTPFileSize})
+		if err != nil && !(flags.Creat && errors.Is(err, os.ErrNotExist)) {
+			tmp.Close()
+			return nil, err
+		}
+	}
+
+	perm := os.FileMode(0o644)
+	if r.AttrFlags().Permissions {
+		perm = r.Attributes().FileMode().Perm()
+	}
+	return &uploadFile{
+		tempFile: tmp,
+		append:   r.Pflags().Append,
+		upload: func(r io.Reader) error {
+			return h.files.WriteFile(name, r, perm)
+		},
+	}, nil
+}
+
+// Filecmd implements sftp.FileCmder.
+func (h *homeHandler) Filecmd(r *sftp.Request) error {
+	name := h.path(r.Filepath)
+	switch r.Method {
+	case "Setstat":
+		flags, attrs := r.AttrFlags(), r.Attributes()
+		if flags.Size {
+			if err := h.files.Truncate(name, int64(attrs.Size)); err != nil {
+				return err
+			}
+		}
+		if flags.Permissions {
+			if err := h.files.Chmod(name, attrs.FileMode()); err != nil {
+				return err
+			}
+		}
+		if flags.Acmodtime {
+			return h.files.Chtimes(name, time.Unix(int64(attrs.Mtime), 0))
+		}
+		return nil
+	case "Rename", "PosixRename":
+		return h.files.Rename(name, h.path(r.Target))
+	case "Rmdir":
+		return h.files.RemoveDir(name)
+	case "Remove":
+		return h.files.Remove(name)
+	case "Mkdir":
+		return h.files.Mkdir(name, 0o755)
+	case "Link":
+		return h.files.Link(name, h.path(r.Target))
+	case "Symlink":
+		// r.Filepath is the link target, and r.Target the link path.
+		return h.files.Symlink(name, h.path(r.Target))
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+// Filelist implements sftp.FileLister.
+func (h *homeHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	name := h.path(r.Filepath)
+	switch r.Method {
+	case "List":
+		infos, err := h.files.ReadDir(name)
+		return listerAt(infos), err
+	case "Stat":
+		info, err := h.files.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{info}, nil
+	case "Readlink":
+		target, err := h.files.Readlink(name)
+		if err != nil {
+			return nil, err
+		}
+		if home := h.files.Home(); target == home || strings.HasPrefix(target, home+"/") {
+			target = "/" + strings.TrimPrefix(strings.TrimPrefix(target, home), "/")
+		}
+		return listerAt{&linkInfo{target}}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// Lstat implements sftp.LstatFileLister.
+func (h *homeHandler) Lstat(r *sftp.Request) (sftp.ListerAt, error) {
+	info, err := h.files.Lstat(h.path(r.Filepath))
+	if err != nil {
+		return nil, err
+	}
+	return listerAt{info}, nil
+}
+
+// Maps the path the client sees to the path in the Pod, where the user's home
+// is the root, so it can't go outside of it.
+func homePath(home, name string) string {
+	return path.Join(home, path.Clean("/"+name))
+}
+
+type listerAt []os.FileInfo
+
+// ListAt implements sftp.ListerAt.
+func (l listerAt) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// linkInfo is the os.FileInfo returned for Readlink, where only the name is
+// used.
+type linkInfo struct {
+	name string
+}
+
+func (li *linkInfo) Name() string       { return li.name }
+func (li *linkInfo) Size() int64        { return 0 }
+func (li *linkInfo) Mode() os.FileMode  { return os.ModeSymlink | 0o777 }
+func (li *linkInfo) ModTime() time.Time { return time.Time{} }
+func (li *linkInfo) IsDir() bool        { return false }
+func (li *linkInfo) Sys() any           { return nil }
+
+// tempFile is a temporary file that is removed when closed.
+type tempFile struct {
+	*os.File
+}
+
+func (t *tempFile) Close() error {
+	defer os.Remove(t.Name())
+	return t.File.Close()
+}
+
+// uploadFile is a temporary file that is uploaded when closed.
+type uploadFile struct {
+	*tempFile
+	upload func(io.Reader) error
+
+	// If append is set, the writes go to the end of the file, whatever their
+	// offset, as with O_APPEND.
+	append bool
+	mu     sync.Mutex
+}
+
+// WriteAt implements io.WriterAt, up to the maximum file size.
+func (u *uploadFile) WriteAt(p []byte, off int64) (int, error) {
+	if u.append {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		info, err := u.Stat()
+		if err != nil {
+			return 0, err
+		}
+		off = info.Size()
+	}
+	if off+int64(len(p)) > maxSFTPFileSize {
+		return 0, errSFTPFileTooLarge
+	}
+	return u.File.WriteAt(p, off)
+}
+
+func (u *uploadFile) Close() error {
+	defer u.tempFile.Close()
+	if _, err := u.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return u.upload(u.File)
+}
+
+// limitedWriter fails if more than n bytes are written to w.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, errSFTPFileTooLarge
+	}
+	l.n -= int64(len(p))
+	return l.w.Write(p)
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+
+	"github.com/ivanvc/boombox/internal/services/local"
+)
+
+// Returns an SFTP client for alice's home, served by the handler with the
+// local backend's files, and the home in the host.
+func newSFTPClient(t *testing.T) (*sftp.Client, string) {
+	t.Helper()
+	b, err := local.New(t.TempDir(), "boombox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := b.NewPodFiles(nil, "alice")
+	if err := os.MkdirAll(files.Home(), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	h := &homeHandler{files: files}
+	rs := sftp.NewRequestServer(serverConn, sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h})
+	go rs.Serve()
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		rs.Close()
+	})
+	return client, files.Home()
+}
+
+// Opens the file with the flags, and writes p at the offset.
+func writeAt(t *testing.T, client *sftp.Client, name string, flags int, p string, off int64) error {
+	t.Helper()
+	f, err := client.OpenFile(name, flags)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt([]byte(p), off); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func TestSFTPWrites(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		flags    int
+		write    string
+		offset   int64
+		want     string
+	}{
+		{"new file", "", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, "hello", 0, "hello"},
+		{"truncated file", "hello world", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, "bye", 0, "bye"},
+		{"write at an offset", "abcdef", os.O_WRONLY, "XY", 2, "abXYef"},
+		{"resumed upload", "hello ", os.O_WRONLY, "world", 6, "hello world"},
+		{"append", "hello ", os.O_WRONLY | os.O_APPEND, "world", 0, "hello world"},
+		{"new file without truncating", "", os.O_WRONLY | os.O_CREATE, "abc", 0, "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, home := newSFTPClient(t)
+			if tt.existing != "" {
+				if err := os.WriteFile(filepath.Join(home, "file"), []byte(tt.existing), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writeAt(t, client, "/file", tt.flags, tt.write, tt.offset); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(filepath.Join(home, "file"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSFTPWriteMissingFileWithoutCreate(t *testing.T) {
+	client, home := newSFTPClient(t)
+	if err := writeAt(t, client, "/file", os.O_WRONLY, "hello", 0); err == nil {
+		t.Error("got no error writing a missing file without O_CREATE")
+	}
+	if _, err := os.Stat(filepath.Join(home, "file")); !os.IsNotExist(err) {
+		t.Errorf("got error %v, want the file not created", err)
+	}
+}
+
+func TestSFTPWriteOverTheLimit(t *testing.T) {
+	client, home := newSFTPClient(t)
+	if err := os.WriteFile(filepath.Join(home, "file"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeAt(t, client, "/file", os.O_WRONLY, "!", maxSFTPFileSize); err == nil {
+		t.Error("got no error writing past the limit")
+	}
+	if got, _ := os.ReadFile(filepath.Join(home, "file")); string(got) != "hello" {
+		t.Errorf("got %q, want the file unchanged", got)
+	}
+}
+
+func TestSFTPRead(t *testing.T) {
+	client, home := newSFTPClient(t)
+	if err := os.WriteFile(filepath.Join(home, "file"), []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The paths can't go outside of the home.
+	f, err := client.Open("/../../file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+}
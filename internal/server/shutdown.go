@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// The time left when the users are warned again about the shutdown.
+var shutdownAnnouncements = []time.Duration{
+	10 * time.Minute,
+	5 * time.Minute,
+	time.Minute,
+	30 * time.Second,
+	10 * time.Second,
+}
+
+// Shutdown stops accepting connections, and warns the users in the Pods with
+// active sessions with a countdown. Once the sessions finish, or the grace
+// period ends, the remaining connections are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shuttingDown.Store(true)
+	graceCtx, cancel := context.WithTimeout(ctx, s.config.ShutdownGracePeriod)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.announceShutdown(graceCtx)
+	}()
+	if err := s.Server.Shutdown(graceCtx); err != nil {
+		log.Info("Closing the remaining connections", "reason", err)
+	}
+	cancel()
+	wg.Wait()
+
+	err := s.Close()
+	s.activeSessions.Wait()
+	s.stopLeases()
+	return err
+}
+
+// Sends a wall with the time left to the Pods with active sessions, at the
+// start of the grace period, and at each of the announcements, until ctx is
+// done.
+func (s *Server) announceShutdown(ctx context.Context) {
+	deadline, _ := ctx.Deadline()
+	for {
+		left := time.Until(deadline).Round(time.Second)
+		s.wallActivePods(shutdownMessage(left, s.config.DeletePodsOnShutdown))
+
+		var next time.Duration = -1
+		for _, d := range shutdownAnnouncements {
+			if d < left {
+				next = d
+				break
+			}
+		}
+		if next < 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(left - next):
+		}
+	}
+}
+
+func shutdownMessage(left time.Duration, deletePods bool) string {
+	when := "now"
+	if left > 0 {
+		when = "in " + left.String()
+	}
+	consequence := "Your box will keep running, log in again to continue."
+	if deletePods {
+		consequence = "Your box will be deleted, save your work."
+	}
+	return fmt.Sprintf("###########################\n Boombox is shutting down %s, and your session will be disconnected.\n %s\n###########################", when, consequence)
+}
+
+// Sends the message to all the sessions in the Pods with active sessions.
+func (s *Server) wallActivePods(message string) {
+	var wg sync.WaitGroup
+	for _, name := range s.activePods() {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			pod, err := s.client.GetPod(name)
+			if pod == nil || err != nil {
+				return
+			}
+			if err := s.client.SendWallToPod(pod, message); err != nil {
+				log.Error("Error sending wall", "pod", name, "error", err)
+			}
+		}(name)
+	}
+	wg.Wait()
+}
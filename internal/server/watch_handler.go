@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+
+	"github.com/ivanvc/boombox/internal/config"
+	"github.com/ivanvc/boombox/internal/identity"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// The keys that stop watching a session: q, Ctrl+C, and Ctrl+D.
+var stopWatchingKeys = map[byte]bool{'q': true, 0x03: true, 0x04: true}
+
+// Mirrors another user's session, read-only, to the sessions with the watch
+// selector (i.e., ssh alice+watch:bob@boombox). Other sessions are passed to
+// the next handler.
+func watchMiddleware(server *Server, cfg *config.Config, users *k8s.UserRegistry) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(sess ssh.Session) {
+			if id, err := server.policy.Resolve(sess.User()); err != nil || id.Selector.Kind != identity.SelectorWatch {
+				next(sess)
+				return
+			}
+
+			id, _, err := resolveUser(server, users, sess.User())
+			if err == nil {
+				err = authorizeWatcher(server, cfg, users, id)
+			}
+			if err != nil {
+				log.Warn("Rejected watcher", "user", sess.User(), "error", err)
+				wish.Fatalln(sess, err)
+				return
+			}
+			if _, _, active := sess.Pty(); !active {
+				wish.Fatalln(sess, "watching a session requires a terminal")
+				return
+			}
+
+			target := id.Selector.Arg
+			viewer, err := server.watches.Watch(identity.ResourceName(target), id.Username)
+			if err != nil {
+				wish.Fatalln(sess, fmt.Errorf("can't watch %s: %w", target, err))
+				return
+			}
+			log.Info("Watching session", "user", id.Username, "target", target)
+			defer log.Info("Stopped watching session", "user", id.Username, "target", target)
+
+			go func() {
+				<-sess.Context().Done()
+				viewer.Close()
+			}()
+			go func() {
+				buf := make([]byte, 256)
+				for {
+					n, err := sess.Read(buf)
+					if err != nil {
+						return
+					}
+					for _, b := range buf[:n] {
+						if stopWatchingKeys[b] {
+							viewer.Close()
+							return
+						}
+					}
+				}
+			}()
+
+			fmt.Fprintf(sess, "\x1b[2J\x1b[HWatching %s's session (%dx%d), press q to stop.\r\n", target, viewer.Width, viewer.Height)
+			for data := range viewer.Output() {
+				sess.Write(data)
+			}
+			fmt.Fprintf(sess, "\r\nStopped watching %s's session.\r\n", target)
+			sess.Exit(0)
+		}
+	}
+}
+
+// Returns an error if the user is not allowed to watch the target's sessions.
+// The configured watchers can watch anyone, and the target's BoomboxUser can
+// allow other users.
+func authorizeWatcher(server *Server, cfg *config.Config, users *k8s.UserRegistry, id *identity.Identity) error {
+	target, err := server.policy.Resolve(id.Selector.Arg)
+	if err != nil {
+		return err
+	}
+	if target.Username == id.Username {
+		return fmt.Errorf("can't watch your own session")
+	}
+	for _, name := range cfg.Watchers {
+		if strings.TrimSpace(name) == id.Username {
+			return nil
+		}
+	}
+	if users != nil {
+		targetAccount, err := users.Get(target.ResourceName)
+		if err != nil {
+			return err
+		}
+		if targetAccount != nil {
+			for _, name := range targetAccount.Spec.Watchers {
+				if name == id.Username {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("user %q is not allowed to watch %q", id.Username, target.Username)
+}
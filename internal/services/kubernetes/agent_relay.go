@@ -0,0 +1,161 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The directory holding the forwarded SSH agent sockets in the Pod.
+const agentSocketDir = "/tmp/boombox-agent"
+
+// The listener accepts any number of connections on the session's socket
+// (socat forks for each one). Every connection gets its own socket, next to
+// the session's one, named after the forked process, which is printed to
+// stderr, so the relay connects it to a new connection to the user's agent.
+// The listener stops when its stdin is closed, as the exec doesn't end its
+// processes. It's run with sh, as the user's login shell may be another one,
+// so it must not have single quotes.
+const agentListenerScript = `
+s=$1
+mkdir -p -m 700 "${s%/*}" || exit 1
+printf "%s\n" "echo connection \$\$ >&2" "exec socat UNIX-LISTEN:\$1.\$\$,unlink-early,mode=600 STDIO" > "$s.sh" || exit 1
+exec 3<&0
+socat -d -d UNIX-LISTEN:$s,fork,unlink-early,mode=600 "EXEC:sh $s.sh $s" &
+pid=$!
+(cat <&3 >/dev/null 2>&1; kill $pid) >/dev/null 2>&1 &
+wait $pid
+status=$?
+rm -f "$s.sh"
+exit $status
+`
+
+// AgentSocket returns the path of the forwarded SSH agent socket in the Pod
+// for the session, which is set as SSH_AUTH_SOCK in the session's
+// environment.
+func AgentSocket(session string) string {
+	// Unix socket paths are limited to 108 bytes.
+	if len(session) > 16 {
+		session = session[:16]
+	}
+	return path.Join(agentSocketDir, session+".sock")
+}
+
+// AgentRelay relays the connections to a session's agent socket in the box to
+// the user's SSH agent.
+type AgentRelay interface {
+	// Run relays the connections, concurrently, until ctx is done. ready is
+	// closed once the socket is listening.
+	Run(ctx context.Context, ready chan<- struct{}) error
+}
+
+// agentRelay runs the listener, and the relays, as commands in the Pod.
+type agentRelay struct {
+	client *Client
+
+	pod    *corev1.Pod
+	user   string
+	socket string
+	open   func() (io.ReadWriteCloser, error)
+}
+
+// Returns a new AgentRelay for the socket (see AgentSocket). open returns a
+// new connection to the user's SSH agent.
+func (c *Client) NewAgentRelay(pod *corev1.Pod, user, socket string, open func() (io.ReadWriteCloser, error)) AgentRelay {
+	return &agentRelay{client: c, pod: pod, user: user, socket: socket, open: open}
+}
+
+// Run implements AgentRelay.
+func (r *agentRelay) Run(ctx context.Context, ready chan<- struct{}) error {
+	var once sync.Once
+	stderr := &listenerWriter{
+		onListening:  func() { once.Do(func() { close(ready) }) },
+		onConnection: func(id int) { go r.relay(ctx, id) },
+	}
+	// Nothing is written to stdin, it's closed when ctx is done, which stops
+	// the listener.
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+
+	command := fmt.Sprintf("sh -c '%s' sh %s", agentListenerScript, r.socket)
+	err := r.client.newCommand(r.pod, r.user, command, nil, stdin, io.Discard, stderr).Run(ctx)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, stderr.output())
+	}
+	return fmt.Errorf("the agent relay stopped: %s", stderr.output())
+}
+
+// Relays the accepted connection with the id to a new connection to the
+// user's agent. If the agent can't be opened, the connection is closed.
+func (r *agentRelay) relay(ctx context.Context, id int) {
+	var stdin io.Reader = strings.NewReader("")
+	var stdout io.Writer = io.Discard
+	agent, err := r.open()
+	if err != nil {
+		log.Error("Error opening the agent", "user", r.user, "error", err)
+	} else {
+		defer agent.Close()
+		stdin, stdout = agent, agent
+	}
+
+	var stderr bytes.Buffer
+	command := fmt.Sprintf("socat UNIX-CONNECT:%s.%d,retry=50,interval=0.1 STDIO", r.socket, id)
+	if err := r.client.newCommand(r.pod, r.user, command, nil, stdin, stdout, &stderr).Run(ctx); err != nil && ctx.Err() == nil {
+		log.Error("Error relaying to the agent", "user", r.user, "error", err, "output", bytes.TrimSpace(stderr.Bytes()))
+	}
+}
+
+// listenerWriter parses the listener's stderr. It calls onListening when socat
+// reports it's listening, and onConnection with the id of every accepted
+// connection.
+type listenerWriter struct {
+	mu           sync.Mutex
+	line         []byte
+	out          bytes.Buffer
+	onListening  func()
+	onConnection func(id int)
+}
+
+func (w *listenerWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.line = append(w.line, p...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.line[:i])
+		w.line = w.line[i+1:]
+
+		if rawID, ok := strings.CutPrefix(line, "connection "); ok {
+			if id, err := strconv.Atoi(rawID); err == nil {
+				w.onConnection(id)
+				continue
+			}
+		}
+		if strings.Contains(line, "listening on") {
+			w.onListening()
+		}
+		w.out.WriteString(line + "\n")
+	}
+	return len(p), nil
+}
+
+// Returns what the listener wrote to stderr, other than the connections.
+func (w *listenerWriter) output() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.TrimSpace(w.out.String() + string(w.line))
+}
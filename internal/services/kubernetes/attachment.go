@@ -1,84 +1,94 @@
 package kubernetes
 
 import (
+	"context"
 	"io"
-	"net/http"
 
+	tea "github.com/charmbracelet/bubbletea"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/remotecommand"
-	"k8s.io/kubectl/pkg/scheme"
 )
 
-// Attachment represents the console (stdin/stdout) attachment to a given Pod.
-type Attachment struct {
-	*Client
+// attachment represents the console (stdin/stdout) attachment to a given Pod.
+type attachment struct {
+	executor Executor
 
-	user string
-	pod  *corev1.Pod
+	user    string
+	command string
+	env     []string
+	pod     *corev1.Pod
 
 	stdin  io.Reader
 	stdout io.Writer
 	stderr io.Writer
 
-	sizeChan SizeChan
+	recorders []Recorder
+	sizeChan  SizeChan
 }
 
-// Returns a new Attachment.
-func (c *Client) NewAttachment(pod *corev1.Pod, user string, sizeChan SizeChan) *Attachment {
-	return &Attachment{Client: c, pod: pod, user: user, sizeChan: sizeChan}
+// Recorder gets a copy of the streams of an attachment, i.e., to record them,
+// or to mirror them to watchers.
+type Recorder interface {
+	// Input records data sent by the user.
+	Input(p []byte)
+	// Output records data sent to the user's terminal.
+	Output(p []byte)
+	// Resize records a change in the terminal size.
+	Resize(width, height uint16)
+	// Close finishes the recording.
+	Close() error
+}
+
+// Returns a new attachment, run with tea.Exec. The user's login shell runs the command, or it's
+// interactive if the command is empty. The env variables, in the NAME=value
+// form, are set in the user's login shell. The recorders get the streams and
+// the terminal size changes.
+func (c *Client) NewAttachment(pod *corev1.Pod, user, command string, env []string, recorders []Recorder, sizeChan SizeChan) tea.ExecCommand {
+	return &attachment{executor: c.executor, pod: pod, user: user, command: command, env: env, recorders: recorders, sizeChan: sizeChan}
 }
 
 // SetStdin implements tea.ExecCommand.
-func (a *Attachment) SetStdin(reader io.Reader) {
+func (a *attachment) SetStdin(reader io.Reader) {
 	a.stdin = reader
 }
 
 // SetStdout implements tea.ExecCommand.
-func (a *Attachment) SetStdout(writer io.Writer) {
+func (a *attachment) SetStdout(writer io.Writer) {
 	a.stdout = writer
 }
 
 // SetStderr implements tea.ExecCommand.
-func (a *Attachment) SetStderr(writer io.Writer) {
+func (a *attachment) SetStderr(writer io.Writer) {
 	a.stderr = writer
 }
 
 // Run implements tea.ExecCommand.
-func (a *Attachment) Run() error {
+func (a *attachment) Run() error {
+	command := loginCommand(a.user, a.env)
+	if a.command != "" {
+		command = loginCommand(a.user, a.env, "-c", a.command)
+	}
 	execOpts := &corev1.PodExecOptions{
 		Container: a.pod.Spec.Containers[0].Name,
-		Command:   []string{"su", "-", a.user},
+		Command:   command,
 		Stdin:     true,
 		Stdout:    true,
 		Stderr:    true,
 		TTY:       true,
 	}
 
-	req := a.CoreV1().RESTClient().Post().
-		Namespace(a.pod.Namespace).
-		Resource("pods").
-		Name(a.pod.Name).
-		SubResource("exec").
-		VersionedParams(execOpts, scheme.ParameterCodec)
-	exec, err := remotecommand.NewSPDYExecutor(
-		a.GetConfig(),
-		http.MethodPost,
-		req.URL(),
-	)
-	if err != nil {
-		return err
-	}
-
 	// Use stdout as stderr, because Bubble Tea assigns os.Stderr when calling
 	// ExecCommand.SetStderr(io.Writer), which would then show the stderr output
 	// on the server's screen rather than the client's.
-	a.stdout.Write([]byte("If you don't see a command prompt, try pressing enter.\n"))
-	err = exec.Stream(remotecommand.StreamOptions{
-		Stdin:             a.stdin,
-		Stdout:            a.stdout,
-		Stderr:            a.stdout,
+	stdin, stdout, sizeQueue := RecordStreams(a.recorders, a.stdin, a.stdout, a.sizeChan)
+
+	stdout.Write([]byte("If you don't see a command prompt, try pressing enter.\n"))
+	err := a.executor.Stream(context.Background(), a.pod, execOpts, remotecommand.StreamOptions{
+		Stdin:             stdin,
+		Stdout:            stdout,
+		Stderr:            stdout,
 		Tty:               true,
-		TerminalSizeQueue: a.sizeChan,
+		TerminalSizeQueue: sizeQueue,
 	})
 
 	if err != nil {
@@ -97,3 +107,36 @@ func (s SizeChan) Next() *remotecommand.TerminalSize {
 	}
 	return &size
 }
+
+// RecordStreams returns the streams, and the terminal size queue, of an
+// attachment, copying them to the recorders.
+func RecordStreams(recorders []Recorder, stdin io.Reader, stdout io.Writer, sizeQueue remotecommand.TerminalSizeQueue) (io.Reader, io.Writer, remotecommand.TerminalSizeQueue) {
+	for _, r := range recorders {
+		stdin = io.TeeReader(stdin, recorderFunc(r.Input))
+		stdout = io.MultiWriter(stdout, recorderFunc(r.Output))
+		sizeQueue = &recordedSizeQueue{sizeQueue, r}
+	}
+	return stdin, stdout, sizeQueue
+}
+
+// recorderFunc adapts a Recorder method to an io.Writer.
+type recorderFunc func(p []byte)
+
+func (f recorderFunc) Write(p []byte) (int, error) {
+	f(p)
+	return len(p), nil
+}
+
+// recordedSizeQueue records the sizes from the queue.
+type recordedSizeQueue struct {
+	queue    remotecommand.TerminalSizeQueue
+	recorder Recorder
+}
+
+func (q *recordedSizeQueue) Next() *remotecommand.TerminalSize {
+	size := q.queue.Next()
+	if size != nil {
+		q.recorder.Resize(size.Width, size.Height)
+	}
+	return size
+}
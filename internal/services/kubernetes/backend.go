@@ -0,0 +1,46 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Backend runs the users' boxes, and the commands in them. Client is the
+// implementation that runs them as Pods in the cluster, on top of an Executor.
+// The commands, files and connections in the boxes are interfaces, so other
+// implementations don't need to go through an Executor.
+type Backend interface {
+	// GetPod returns the Pod by name, or nil if it doesn't exist.
+	GetPod(name string) (*corev1.Pod, error)
+	// GetPVC returns the PVC by name, or nil if it doesn't exist.
+	GetPVC(name string) (*corev1.PersistentVolumeClaim, error)
+	CreatePVC(name, username, size string) (*corev1.PersistentVolumeClaim, error)
+	WaitForPVC(pvc *corev1.PersistentVolumeClaim) error
+	CreatePod(name, username, image string, pvc *corev1.PersistentVolumeClaim, user *BoomboxUser) (*corev1.Pod, error)
+	CreateInitialPod(name, username, image string, pvc *corev1.PersistentVolumeClaim, user *BoomboxUser) (*corev1.Pod, error)
+	WaitForPodInitContainer(pod *corev1.Pod) (PodStatus, error)
+	DeletePod(pod *corev1.Pod) error
+	DeletePodIfUnchanged(pod *corev1.Pod) (bool, error)
+	ListManagedPods() ([]corev1.Pod, error)
+
+	RenewSessionLeases(name, replica string, ids []string) error
+	ReleaseSessionLease(name, id string) error
+	AcquireProvisioningLock(ctx context.Context, name, holder string, timeout time.Duration) (ProvisioningLock, error)
+
+	ListSessions(pod *corev1.Pod, user string, multiplexer bool) ([]Session, error)
+	KillSession(pod *corev1.Pod, user string, session Session) error
+	SendWallToPod(pod *corev1.Pod, message string) error
+
+	NewAttachment(pod *corev1.Pod, user, command string, env []string, recorders []Recorder, sizeChan SizeChan) tea.ExecCommand
+	NewCommand(pod *corev1.Pod, user, command string, env []string, stdin io.Reader, stdout, stderr io.Writer) Command
+	NewLogTail(pod *corev1.Pod, linesChan chan string) LogTail
+	NewAgentRelay(pod *corev1.Pod, user, socket string, open func() (io.ReadWriteCloser, error)) AgentRelay
+	NewPodFiles(pod *corev1.Pod, user string) PodFiles
+	DialPod(pod *corev1.Pod, port uint16) (PodConn, error)
+}
+
+var _ Backend = (*Client)(nil)
@@ -3,9 +3,8 @@ package kubernetes
 import (
 	"bytes"
 	"context"
-	"net/http"
-	"strconv"
-	"strings"
+	"fmt"
+	"time"
 
 	"github.com/charmbracelet/log"
 	corev1 "k8s.io/api/core/v1"
@@ -15,7 +14,6 @@ import (
 	k8s "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
-	"k8s.io/kubectl/pkg/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -28,10 +26,23 @@ const (
 	PodStatusReady
 )
 
+// ErrNoConfig is returned by the features that need to connect to the cluster
+// directly, when the Client has no config.
+var ErrNoConfig = fmt.Errorf("the Kubernetes client has no config")
+
+var errPodDeletedWhileStarting = fmt.Errorf("the box was deleted while starting, try again in a moment")
+
+// The bounds of the backoff between the watches of a starting Pod.
+const (
+	minWatchBackoff = 100 * time.Millisecond
+	maxWatchBackoff = 5 * time.Second
+)
+
 // Client holds a wrapped Kubernetes client.
 type Client struct {
-	*k8s.Clientset
+	k8s.Interface
 	config    *rest.Config
+	executor  Executor
 	namespace string
 }
 
@@ -45,7 +56,18 @@ func LoadClient(namespace string) *Client {
 	if err != nil {
 		log.Fatal("Error initializing Kubernetes client", "error", err)
 	}
-	return &Client{cs, cfg, namespace}
+	return NewClient(cs, cfg, nil, namespace)
+}
+
+// NewClient returns a new Client for the namespace, with the clientset. If
+// executor is nil, the commands run through the Pod's exec subresource, with
+// the config. config may be nil if there's no cluster (i.e., in tests), but
+// then the user registry and port forwarding are not available.
+func NewClient(clientset k8s.Interface, config *rest.Config, executor Executor, namespace string) *Client {
+	if executor == nil {
+		executor = &spdyExecutor{clientset, config}
+	}
+	return &Client{clientset, config, executor, namespace}
 }
 
 // Gets client Config.
@@ -85,14 +107,54 @@ func (c *Client) GetPVC(name string) (*corev1.PersistentVolumeClaim, error) {
 	return pvc, nil
 }
 
-// Creates a PVC by name with a given size.
-func (c *Client) CreatePVC(name, size string) (*corev1.PersistentVolumeClaim, error) {
-	pvc := getPVCPayload(c.namespace, name, size)
-	if _, err := c.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(
+// Get a Secret by name from the cluster.
+func (c *Client) GetSecret(name string) (*corev1.Secret, error) {
+	secret, err := c.CoreV1().Secrets(c.namespace).Get(
 		context.Background(),
-		pvc,
+		name,
+		metav1.GetOptions{},
+	)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return secret, nil
+}
+
+// Get a ConfigMap by name from the cluster.
+func (c *Client) GetConfigMap(name string) (*corev1.ConfigMap, error) {
+	cm, err := c.CoreV1().ConfigMaps(c.namespace).Get(
+		context.Background(),
+		name,
+		metav1.GetOptions{},
+	)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return cm, nil
+}
+
+// Creates a PVC by name with a given size, for the Unix username. If the PVC
+// already exists (i.e., another replica created it), it returns that one.
+func (c *Client) CreatePVC(name, username, size string) (*corev1.PersistentVolumeClaim, error) {
+	payload, err := getPVCPayload(c.namespace, name, username, size)
+	if err != nil {
+		return nil, err
+	}
+	pvc, err := c.CoreV1().PersistentVolumeClaims(c.namespace).Create(
+		context.Background(),
+		payload,
 		metav1.CreateOptions{},
-	); err != nil {
+	)
+	if errors.IsAlreadyExists(err) {
+		return c.CoreV1().PersistentVolumeClaims(c.namespace).Get(context.Background(), name, metav1.GetOptions{})
+	}
+	if err != nil {
 		return nil, err
 	}
 	return pvc, nil
@@ -119,66 +181,121 @@ func (c *Client) WaitForPVC(pvc *corev1.PersistentVolumeClaim) error {
 	return nil
 }
 
-// Creates a Pod in the cluster with a given name, container image, and a pvc that will be mounted on /home.
-func (c *Client) CreatePod(name, image string, pvc *corev1.PersistentVolumeClaim) (*corev1.Pod, error) {
-	pod := getPodPayload(c.namespace, name, image, pvc)
-	if err := c.createPod(pod); err != nil {
-		return nil, err
-	}
-	return pod, nil
+// Creates a Pod in the cluster with a given name, for the Unix username, container image, and a pvc that will be mounted on /home.
+// The user's BoomboxUser, if not nil, sets the container resources.
+func (c *Client) CreatePod(name, username, image string, pvc *corev1.PersistentVolumeClaim, user *BoomboxUser) (*corev1.Pod, error) {
+	return c.createPod(getPodPayload(c.namespace, name, username, image, pvc, user))
 }
 
-// Creates a Pod with an init container that provisions the user home, in the cluster with a given name, container image, and a pvc that will be mounted on /home.
-func (c *Client) CreateInitialPod(name, image string, pvc *corev1.PersistentVolumeClaim) (*corev1.Pod, error) {
-	pod := getInitialPodPayload(c.namespace, name, image, pvc)
-	if err := c.createPod(pod); err != nil {
-		return nil, err
-	}
-	return pod, nil
+// Creates a Pod with an init container that provisions the user home, in the cluster with a given name, for the Unix username, container image, and a pvc that will be mounted on /home.
+// The user's BoomboxUser, if not nil, sets the container resources.
+func (c *Client) CreateInitialPod(name, username, image string, pvc *corev1.PersistentVolumeClaim, user *BoomboxUser) (*corev1.Pod, error) {
+	return c.createPod(getInitialPodPayload(c.namespace, name, username, image, pvc, user))
 }
 
-func (c *Client) createPod(pod *corev1.Pod) error {
-	if _, err := c.CoreV1().Pods(pod.Namespace).Create(
+// Creates the Pod. If it already exists (i.e., another replica created it),
+// it returns that one, unless it's being deleted.
+func (c *Client) createPod(pod *corev1.Pod) (*corev1.Pod, error) {
+	created, err := c.CoreV1().Pods(pod.Namespace).Create(
 		context.Background(),
 		pod,
 		metav1.CreateOptions{},
-	); err != nil {
-		return err
+	)
+	if err == nil {
+		return created, nil
+	}
+	if !errors.IsAlreadyExists(err) {
+		return nil, err
 	}
 
-	return nil
+	existing, err := c.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if existing.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("the box is being deleted, try again in a moment")
+	}
+	return existing, nil
 }
 
-// Waits for a Pod to be scheduled.
+// Waits for a Pod to be scheduled. If the Pod can't start, it returns a
+// PodStartupError. The given Pod is checked first, as it may have already
+// failed or be ready. Then it's watched from its version, and watched again,
+// after a backoff, if the watch is closed. If its version is too old to watch
+// (i.e., after a compaction), the Pod is fetched again.
 func (c *Client) WaitForPodInitContainer(pod *corev1.Pod) (PodStatus, error) {
+	backoff := minWatchBackoff
+	for {
+		if err := podStartupError(pod); err != nil {
+			return PodStatusUnknown, err
+		}
+		if podReady(pod) {
+			return PodStatusReady, nil
+		}
+		status, last, err := c.watchPodStartup(pod)
+		if errors.IsGone(err) || errors.IsResourceExpired(err) {
+			last, err = c.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				return PodStatusUnknown, errPodDeletedWhileStarting
+			}
+		}
+		if err != nil || status != PodStatusUnknown {
+			return status, err
+		}
+		pod = last
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+	}
+}
+
+// Watches the Pod until its init container runs, it's ready, or it can't
+// start. If the watch is closed before, it returns PodStatusUnknown, and the
+// last version of the Pod.
+func (c *Client) watchPodStartup(pod *corev1.Pod) (PodStatus, *corev1.Pod, error) {
 	w, err := c.CoreV1().Pods(pod.Namespace).Watch(
 		context.Background(),
 		metav1.SingleObject(pod.ObjectMeta),
 	)
 	if err != nil {
-		return PodStatusUnknown, err
+		return PodStatusUnknown, nil, err
 	}
+	defer w.Stop()
 
 	for event := range w.ResultChan() {
 		switch event.Type {
-		case watch.Modified:
+		case watch.Error:
+			return PodStatusUnknown, nil, errors.FromObject(event.Object)
+		case watch.Deleted:
+			return PodStatusUnknown, nil, errPodDeletedWhileStarting
+		case watch.Added, watch.Modified:
 			pod = event.Object.(*corev1.Pod)
+			if err := podStartupError(pod); err != nil {
+				return PodStatusUnknown, nil, err
+			}
 			for _, status := range pod.Status.InitContainerStatuses {
 				if status.Name == "init" && status.State.Running != nil {
-					w.Stop()
-					return PodStatusInitContainerReady, nil
+					return PodStatusInitContainerReady, nil, nil
 				}
 			}
-			for _, cond := range pod.Status.Conditions {
-				if cond.Type == corev1.PodReady &&
-					cond.Status == corev1.ConditionTrue {
-					w.Stop()
-					return PodStatusReady, nil
-				}
+			if podReady(pod) {
+				return PodStatusReady, nil, nil
 			}
 		}
 	}
-	return PodStatusUnknown, nil
+	return PodStatusUnknown, pod, nil
+}
+
+// Returns true if the Pod is ready.
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
 }
 
 // Deletes a Pod.
@@ -191,24 +308,10 @@ func (c *Client) DeletePod(pod *corev1.Pod) error {
 	return err
 }
 
-// Query for active PTYs in a Pod.
-func (c *Client) GetActivePTYs(pod *corev1.Pod) (int, error) {
-	stdout, err := c.execCommandInPod(pod, "/bin/sh", "-c", "find /dev/pts -group tty | wc -l")
-	if err != nil {
-		return -1, err
-	}
-
-	conn, err := strconv.Atoi(strings.TrimSpace(stdout))
-	if err != nil {
-		return -1, err
-	}
-
-	return conn, nil
-}
-
-// Send a wall about the shutdown to all session in the Pod.
-func (c *Client) SendShutdownWallToPod(pod *corev1.Pod) error {
-	_, err := c.execCommandInPod(pod, "/bin/sh", "-c", "for pty in $(find /dev/pts -group tty); do echo -e '\n###########################\n The system is going down! \n\n' > $pty; done")
+// Writes the message to all the sessions (PTYs) in the Pod, like wall(1).
+func (c *Client) SendWallToPod(pod *corev1.Pod, message string) error {
+	script := `for pty in $(find /dev/pts -group tty); do printf '\r\n%s\r\n' "$1" > "$pty"; done`
+	_, err := c.execCommandInPod(pod, "/bin/sh", "-c", script, "sh", message)
 	return err
 }
 
@@ -221,20 +324,9 @@ func (c *Client) execCommandInPod(pod *corev1.Pod, command ...string) (string, e
 		Stderr:    false,
 		TTY:       false,
 	}
-	req := c.CoreV1().RESTClient().Post().
-		Namespace(pod.Namespace).
-		Resource("pods").
-		Name(pod.Name).
-		SubResource("exec").
-		VersionedParams(execOpts, scheme.ParameterCodec)
-
-	exec, err := remotecommand.NewSPDYExecutor(c.config, http.MethodPost, req.URL())
-	if err != nil {
-		return "", err
-	}
 
 	var stdout bytes.Buffer
-	err = exec.Stream(remotecommand.StreamOptions{
+	err := c.executor.Stream(context.Background(), pod, execOpts, remotecommand.StreamOptions{
 		Stdin:  nil,
 		Stdout: &stdout,
 		Stderr: nil,
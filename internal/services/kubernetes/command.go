@@ -0,0 +1,68 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Command is a non-interactive command run as the user in a box.
+type Command interface {
+	// Run runs the command until it exits, or ctx is done. If the command
+	// exits with a non-zero status, it returns an exec.CodeExitError.
+	Run(ctx context.Context) error
+}
+
+// command runs a Command in a Pod, with separate stdout and stderr streams.
+type command struct {
+	executor Executor
+
+	user    string
+	command string
+	env     []string
+	pod     *corev1.Pod
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// Returns a new Command. The command is run by the user's login shell, with the
+// env variables in the NAME=value form.
+func (c *Client) NewCommand(pod *corev1.Pod, user, cmd string, env []string, stdin io.Reader, stdout, stderr io.Writer) Command {
+	return c.newCommand(pod, user, cmd, env, stdin, stdout, stderr)
+}
+
+func (c *Client) newCommand(pod *corev1.Pod, user, cmd string, env []string, stdin io.Reader, stdout, stderr io.Writer) *command {
+	return &command{
+		executor: c.executor,
+		pod:      pod,
+		user:     user,
+		command:  cmd,
+		env:      env,
+		stdin:    stdin,
+		stdout:   stdout,
+		stderr:   stderr,
+	}
+}
+
+// Run implements Command.
+func (c *command) Run(ctx context.Context) error {
+	execOpts := &corev1.PodExecOptions{
+		Container: c.pod.Spec.Containers[0].Name,
+		Command:   loginCommand(c.user, c.env, "-c", c.command),
+		Stdin:     c.stdin != nil,
+		Stdout:    true,
+		Stderr:    true,
+		TTY:       false,
+	}
+
+	return c.executor.Stream(ctx, c.pod, execOpts, remotecommand.StreamOptions{
+		Stdin:  c.stdin,
+		Stdout: c.stdout,
+		Stderr: c.stderr,
+		Tty:    false,
+	})
+}
@@ -0,0 +1,41 @@
+package kubernetes
+
+import (
+	"context"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/kubectl/pkg/scheme"
+)
+
+// Executor runs commands in a Pod's container, like kubectl exec.
+type Executor interface {
+	// Stream runs the command in opts, and copies the streams until it exits,
+	// or ctx is done. If the command exits with a non-zero status, it returns
+	// an exec.CodeExitError.
+	Stream(ctx context.Context, pod *corev1.Pod, opts *corev1.PodExecOptions, streams remotecommand.StreamOptions) error
+}
+
+// spdyExecutor runs the commands through the Pod's exec subresource.
+type spdyExecutor struct {
+	clientset k8s.Interface
+	config    *rest.Config
+}
+
+// Stream implements Executor.
+func (e *spdyExecutor) Stream(ctx context.Context, pod *corev1.Pod, opts *corev1.PodExecOptions, streams remotecommand.StreamOptions) error {
+	req := e.clientset.CoreV1().RESTClient().Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(opts, scheme.ParameterCodec)
+	exec, err := remotecommand.NewSPDYExecutor(e.config, http.MethodPost, req.URL())
+	if err != nil {
+		return err
+	}
+	return exec.StreamWithContext(ctx, streams)
+}
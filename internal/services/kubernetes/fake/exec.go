@@ -0,0 +1,126 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+)
+
+// Handler runs a command in the Exec, with the streams.
+type Handler func(ctx context.Context, streams remotecommand.StreamOptions) error
+
+// Command is a command run by the Exec.
+type Command struct {
+	Pod  string
+	Args []string
+	TTY  bool
+}
+
+// Line returns the command's args joined by spaces.
+func (c Command) Line() string {
+	return strings.Join(c.Args, " ")
+}
+
+// Exec is a scripted kubernetes.Executor. The commands without a TTY run the
+// most recent Handler whose pattern they contain, and the ones with a TTY,
+// like the user's shell, run Shell. Without a Handler, the commands exit with
+// status 0, and no output.
+type Exec struct {
+	// Shell runs the commands with a TTY.
+	Shell Handler
+
+	mu       sync.Mutex
+	handlers []pattern
+	commands []Command
+	sizes    []remotecommand.TerminalSize
+}
+
+type pattern struct {
+	substring string
+	handler   Handler
+}
+
+// Handle runs h for the commands that contain substring.
+func (e *Exec) Handle(substring string, h Handler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers = append(e.handlers, pattern{substring, h})
+}
+
+// Commands returns the commands run so far.
+func (e *Exec) Commands() []Command {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Command(nil), e.commands...)
+}
+
+// Sizes returns the terminal sizes sent to the commands with a TTY.
+func (e *Exec) Sizes() []remotecommand.TerminalSize {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]remotecommand.TerminalSize(nil), e.sizes...)
+}
+
+// Stream implements kubernetes.Executor.
+func (e *Exec) Stream(ctx context.Context, pod *corev1.Pod, opts *corev1.PodExecOptions, streams remotecommand.StreamOptions) error {
+	cmd := Command{Pod: pod.Name, Args: opts.Command, TTY: opts.TTY}
+	e.mu.Lock()
+	e.commands = append(e.commands, cmd)
+	h := e.handler(cmd)
+	e.mu.Unlock()
+
+	if streams.TerminalSizeQueue != nil {
+		go e.readSizes(streams.TerminalSizeQueue)
+	}
+	if h == nil {
+		return nil
+	}
+	return h(ctx, streams)
+}
+
+func (e *Exec) handler(cmd Command) Handler {
+	if cmd.TTY {
+		return e.Shell
+	}
+	line := cmd.Line()
+	for i := len(e.handlers) - 1; i >= 0; i-- {
+		if strings.Contains(line, e.handlers[i].substring) {
+			return e.handlers[i].handler
+		}
+	}
+	return nil
+}
+
+// Reads the sizes until the queue is done, like the exec subresource.
+func (e *Exec) readSizes(queue remotecommand.TerminalSizeQueue) {
+	for size := queue.Next(); size != nil; size = queue.Next() {
+		e.mu.Lock()
+		e.sizes = append(e.sizes, *size)
+		e.mu.Unlock()
+	}
+}
+
+// Output returns a Handler that writes stdout, and exits with the status code.
+func Output(stdout string, code int) Handler {
+	return func(_ context.Context, streams remotecommand.StreamOptions) error {
+		if streams.Stdout != nil {
+			io.WriteString(streams.Stdout, stdout)
+		}
+		return ExitError(code)
+	}
+}
+
+// ExitError returns the error of a command that exits with the status code,
+// or nil if it's 0.
+func ExitError(code int) error {
+	if code == 0 {
+		return nil
+	}
+	return exec.CodeExitError{Err: fmt.Errorf("command terminated with exit code %d", code), Code: code}
+}
@@ -0,0 +1,143 @@
+// Package fake provides an in-memory kubernetes.Backend, to run boombox
+// without a cluster in tests.
+package fake
+
+import (
+	"net"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// Namespace is the namespace of the Backend's objects.
+const Namespace = "boombox"
+
+// Backend is a kubernetes.Client with the objects in memory, and a scripted
+// Executor. There's no kubelet, the Pods and PVCs make progress when they are
+// watched, i.e., by WaitForPodInitContainer and WaitForPVC.
+type Backend struct {
+	*k8s.Client
+	// Clientset holds the objects.
+	Clientset *k8sfake.Clientset
+	// Exec runs the commands in the Pods.
+	Exec *Exec
+	// StartPod changes the status of a Pod each time it's watched. It's
+	// StartPod by default, tests replace it to make the Pods fail to start.
+	StartPod func(pod *corev1.Pod)
+}
+
+// New returns a new Backend with the objects.
+func New(objects ...runtime.Object) *Backend {
+	cs := k8sfake.NewSimpleClientset(objects...)
+	b := &Backend{Clientset: cs, Exec: &Exec{}, StartPod: StartPod}
+	b.Client = k8s.NewClient(cs, nil, b.Exec, Namespace)
+	cs.PrependWatchReactor("persistentvolumeclaims", b.watch(func(obj runtime.Object) {
+		obj.(*corev1.PersistentVolumeClaim).Status.Phase = corev1.ClaimBound
+	}))
+	cs.PrependWatchReactor("pods", b.watch(func(obj runtime.Object) {
+		b.StartPod(obj.(*corev1.Pod))
+	}))
+	return b
+}
+
+// BoundPVC returns a bound PVC with the name, as the one of a returning user.
+func BoundPVC(name string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+	}
+}
+
+// RunningPod returns a running Pod with the name, created by boombox for the
+// username, as the one of a user with a session.
+func RunningPod(name, username string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         Namespace,
+			Labels:            map[string]string{k8s.ManagedByLabel: "boombox"},
+			Annotations:       map[string]string{k8s.UsernameAnnotation: username},
+			CreationTimestamp: metav1.Now(),
+		},
+		Spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "ubuntu"}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+// StartPod moves the Pod a step in its startup, like the kubelet would: first
+// the init container runs, and then the Pod is Running and Ready.
+func StartPod(pod *corev1.Pod) {
+	if len(pod.Spec.InitContainers) > 0 && len(pod.Status.InitContainerStatuses) == 0 {
+		pod.Status.Phase = corev1.PodPending
+		pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+			Name:  pod.Spec.InitContainers[0].Name,
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+		}}
+		return
+	}
+	for i := range pod.Status.InitContainerStatuses {
+		pod.Status.InitContainerStatuses[i].State = corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"},
+		}
+	}
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+}
+
+// DialPod implements kubernetes.Backend. There's no Pod network, so it
+// connects to the port in the host's loopback address, like the local backend.
+func (b *Backend) DialPod(pod *corev1.Pod, port uint16) (k8s.PodConn, error) {
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.TCPConn), nil
+}
+
+// Returns the reactor that watches a single object, and updates it with
+// progress once the watch is started, so the watcher gets the Modified event.
+func (b *Backend) watch(progress func(obj runtime.Object)) k8stesting.WatchReactionFunc {
+	return func(action k8stesting.Action) (bool, watch.Interface, error) {
+		tracker := b.Clientset.Tracker()
+		gvr, ns := action.GetResource(), action.GetNamespace()
+		w, err := tracker.Watch(gvr, ns)
+		if err != nil {
+			return true, nil, err
+		}
+
+		restrictions := action.(k8stesting.WatchActionImpl).GetWatchRestrictions()
+		name, ok := restrictions.Fields.RequiresExactMatch("metadata.name")
+		if !ok {
+			return true, w, nil
+		}
+		w = watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+			obj, err := meta.Accessor(event.Object)
+			return event, err == nil && obj.GetName() == name
+		})
+
+		obj, err := tracker.Get(gvr, ns, name)
+		if err != nil {
+			return true, w, nil
+		}
+		updated := obj.DeepCopyObject()
+		progress(updated)
+		// Like the API server, there's no event if nothing changed.
+		if equality.Semantic.DeepEqual(obj, updated) {
+			return true, w, nil
+		}
+		if err := tracker.Update(gvr, updated, ns); err != nil {
+			w.Stop()
+			return true, nil, err
+		}
+		return true, w, nil
+	}
+}
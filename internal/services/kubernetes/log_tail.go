@@ -6,22 +6,29 @@ import (
 
 	"github.com/charmbracelet/log"
 	corev1 "k8s.io/api/core/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
-// LogTail is the struct that tails the logs for a Pod's container.
-type LogTail struct {
-	*Client
+// LogTail tails the logs of a box's container.
+type LogTail interface {
+	// Run follows the log lines, and sends them to the linesChan.
+	Run(container string) error
+}
+
+// logTail is the struct that tails the logs for a Pod's container.
+type logTail struct {
+	pods      corev1client.PodInterface
 	pod       *corev1.Pod
 	linesChan chan string
 }
 
 // NewLogTail returns a new LogTail instance.
-func (c *Client) NewLogTail(pod *corev1.Pod, linesChan chan string) *LogTail {
-	return &LogTail{c, pod, linesChan}
+func (c *Client) NewLogTail(pod *corev1.Pod, linesChan chan string) LogTail {
+	return &logTail{c.CoreV1().Pods(pod.Namespace), pod, linesChan}
 }
 
-// Run follows the log lines, and sends them to the linesChan.
-func (lt *LogTail) Run(container string) error {
+// Run implements LogTail.
+func (lt *logTail) Run(container string) error {
 	count := int64(100)
 	podLogOptions := corev1.PodLogOptions{
 		Container: container,
@@ -29,8 +36,7 @@ func (lt *LogTail) Run(container string) error {
 		TailLines: &count,
 	}
 
-	podLogRequest := lt.CoreV1().Pods(lt.pod.Namespace).
-		GetLogs(lt.pod.Name, &podLogOptions)
+	podLogRequest := lt.pods.GetLogs(lt.pod.Name, &podLogOptions)
 	stream, err := podLogRequest.Stream(context.Background())
 	if err != nil {
 		return err
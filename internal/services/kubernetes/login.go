@@ -0,0 +1,19 @@
+package kubernetes
+
+import "strings"
+
+// Returns the command that runs the user's login shell with su, and args.
+// su only keeps TERM from the environment, so the env variables (in the
+// NAME=value form) are set with env, and allowed with --whitelist-environment.
+func loginCommand(user string, env []string, args ...string) []string {
+	command := []string{"su", "-", user}
+	if len(env) > 0 {
+		names := make([]string, 0, len(env))
+		for _, v := range env {
+			name, _, _ := strings.Cut(v, "=")
+			names = append(names, name)
+		}
+		command = append(append([]string{"env"}, env...), append(command, "-w", strings.Join(names, ","))...)
+	}
+	return append(command, args...)
+}
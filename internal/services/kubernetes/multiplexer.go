@@ -0,0 +1,83 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The format of tmux list-sessions, one tab separated line per session, with
+// the session's active pane.
+const multiplexerSessionFormat = "#{session_name}\t#{session_created}\t#{session_activity}\t#{session_attached}\t#{pane_tty}\t#{pane_current_command}"
+
+// NewMultiplexerSessionCommand returns the command that starts the user's
+// shell in a new multiplexer session with the name.
+func NewMultiplexerSessionCommand(name string) string {
+	return "exec tmux new-session -s " + shellQuote(name)
+}
+
+// NewMultiplexerSessionName returns the name for a new multiplexer session,
+// the lowest number that none of the sessions has, like tmux names them.
+func NewMultiplexerSessionName(sessions []Session) string {
+	names := make(map[string]bool, len(sessions))
+	for _, s := range sessions {
+		names[s.ID] = true
+	}
+	for i := 0; ; i++ {
+		if name := strconv.Itoa(i); !names[name] {
+			return name
+		}
+	}
+}
+
+// AttachMultiplexerSessionCommand returns the command that attaches to the
+// multiplexer session, read-only if readOnly is true.
+func AttachMultiplexerSessionCommand(name string, readOnly bool) string {
+	command := "exec tmux attach-session"
+	if readOnly {
+		command += " -r"
+	}
+	return command + " -t " + shellQuote("="+name)
+}
+
+// ListMultiplexerSessions returns the user's tmux sessions in the box, running
+// tmux with the backend's commands.
+func ListMultiplexerSessions(b Backend, pod *corev1.Pod, user string) ([]Session, error) {
+	var stdout bytes.Buffer
+	// tmux fails if there's no server running, which means there are no
+	// sessions.
+	script := "tmux list-sessions -F " + shellQuote(multiplexerSessionFormat) + " 2>/dev/null || true"
+	if err := b.NewCommand(pod, user, script, nil, nil, &stdout, nil).Run(context.Background()); err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 {
+			continue
+		}
+		created, _ := strconv.ParseInt(fields[1], 10, 64)
+		activity, _ := strconv.ParseInt(fields[2], 10, 64)
+		attached, _ := strconv.Atoi(fields[3])
+		sessions = append(sessions, Session{
+			ID:          fields[0],
+			TTY:         strings.TrimPrefix(fields[4], "/dev/"),
+			Started:     time.Unix(created, 0),
+			Activity:    time.Unix(activity, 0),
+			Command:     fields[5],
+			Attached:    attached,
+			Multiplexed: true,
+		})
+	}
+	return sessions, nil
+}
+
+// KillMultiplexerSession kills the user's tmux session in the box.
+func KillMultiplexerSession(b Backend, pod *corev1.Pod, user, name string) error {
+	return b.NewCommand(pod, user, "tmux kill-session -t "+shellQuote("="+name), nil, nil, nil, nil).Run(context.Background())
+}
@@ -0,0 +1,333 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+)
+
+// The find formats for the file info: name (or path), size, permissions,
+// modification time and type, separated by NUL.
+const (
+	fileInfoFormat = `%f\0%s\0%m\0%T@\0%y\0`
+	walkFormat     = `%p\0%s\0%m\0%T@\0%y\0`
+)
+
+// PodFiles gives access to the files in a box as the user, with the same
+// permissions as in the user's shell. The errors are like the os package's,
+// i.e., they wrap os.ErrNotExist if the file doesn't exist.
+type PodFiles interface {
+	// Home returns the user's home directory.
+	Home() string
+	// Stat returns the FileInfo for the file at name, following symbolic
+	// links.
+	Stat(name string) (os.FileInfo, error)
+	// Lstat returns the FileInfo for the file at name, without following
+	// symbolic links.
+	Lstat(name string) (os.FileInfo, error)
+	// ReadDir returns the FileInfo of the files in the directory.
+	ReadDir(name string) ([]os.FileInfo, error)
+	// Walk returns the paths and FileInfo of the file tree rooted at name,
+	// with directories before their contents.
+	Walk(name string) ([]string, []os.FileInfo, error)
+	// Glob returns the paths matching the shell pattern.
+	Glob(pattern string) ([]string, error)
+	// ReadFile writes the contents of the file to w.
+	ReadFile(name string, w io.Writer) error
+	// WriteFile replaces the contents of the file with r, creating it with
+	// the given permissions if it doesn't exist.
+	WriteFile(name string, r io.Reader, perm os.FileMode) error
+	// Mkdir creates the directory with the given permissions.
+	Mkdir(name string, perm os.FileMode) error
+	// Remove removes the file.
+	Remove(name string) error
+	// RemoveDir removes the empty directory.
+	RemoveDir(name string) error
+	// Rename moves the file from oldname to newname.
+	Rename(oldname, newname string) error
+	// Symlink creates newname as a symbolic link to oldname.
+	Symlink(oldname, newname string) error
+	// Link creates newname as a hard link to oldname.
+	Link(oldname, newname string) error
+	// Readlink returns the destination of the symbolic link.
+	Readlink(name string) (string, error)
+	// Chmod changes the permissions of the file.
+	Chmod(name string, mode os.FileMode) error
+	// Truncate changes the size of the file.
+	Truncate(name string, size int64) error
+	// Chtimes changes the modification time of the file.
+	Chtimes(name string, mtime time.Time) error
+}
+
+// podFiles implements PodFiles by executing commands in the Pod's container.
+// Commands run as the user, so they have the same permissions as in the
+// user's shell.
+type podFiles struct {
+	executor Executor
+
+	user string
+	pod  *corev1.Pod
+}
+
+// NewPodFiles returns a new PodFiles.
+func (c *Client) NewPodFiles(pod *corev1.Pod, user string) PodFiles {
+	return &podFiles{executor: c.executor, pod: pod, user: user}
+}
+
+// Home implements PodFiles.
+func (f *podFiles) Home() string {
+	return path.Join("/home", f.user)
+}
+
+// Stat implements PodFiles.
+func (f *podFiles) Stat(name string) (os.FileInfo, error) {
+	return f.stat("stat", "find -L "+shellQuote(name)+" -maxdepth 0 -printf '"+fileInfoFormat+"'", name)
+}
+
+// Lstat implements PodFiles.
+func (f *podFiles) Lstat(name string) (os.FileInfo, error) {
+	return f.stat("lstat", "find "+shellQuote(name)+" -maxdepth 0 -printf '"+fileInfoFormat+"'", name)
+}
+
+func (f *podFiles) stat(op, script, name string) (os.FileInfo, error) {
+	var stdout bytes.Buffer
+	if err := f.run(op, name, script, nil, &stdout); err != nil {
+		return nil, err
+	}
+	infos, err := parseFileInfos(stdout.Bytes())
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	if len(infos) != 1 {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return infos[0], nil
+}
+
+// ReadDir implements PodFiles.
+func (f *podFiles) ReadDir(name string) ([]os.FileInfo, error) {
+	var stdout bytes.Buffer
+	script := "find " + shellQuote(name) + " -mindepth 1 -maxdepth 1 -printf '" + fileInfoFormat + "'"
+	if err := f.run("readdir", name, script, nil, &stdout); err != nil {
+		return nil, err
+	}
+	infos, err := parseFileInfos(stdout.Bytes())
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return infos, nil
+}
+
+// Walk implements PodFiles.
+func (f *podFiles) Walk(name string) ([]string, []os.FileInfo, error) {
+	var stdout bytes.Buffer
+	script := "find " + shellQuote(name) + " -printf '" + walkFormat + "'"
+	if err := f.run("walk", name, script, nil, &stdout); err != nil {
+		return nil, nil, err
+	}
+	infos, err := parseFileInfos(stdout.Bytes())
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "walk", Path: name, Err: err}
+	}
+	paths := make([]string, len(infos))
+	for i, info := range infos {
+		fi := info.(*fileInfo)
+		paths[i] = fi.name
+		fi.name = path.Base(fi.name)
+	}
+	return paths, infos, nil
+}
+
+// Glob implements PodFiles.
+func (f *podFiles) Glob(pattern string) ([]string, error) {
+	var stdout bytes.Buffer
+	// With an empty IFS, the unquoted variable only goes through pathname
+	// expansion.
+	script := "IFS=; p=" + shellQuote(pattern) + `; for f in $p; do [ -e "$f" ] && printf '%s\0' "$f"; done; true`
+	if err := f.run("glob", pattern, script, nil, &stdout); err != nil {
+		return nil, err
+	}
+	matches := strings.Split(stdout.String(), "\x00")
+	return matches[:len(matches)-1], nil
+}
+
+// ReadFile implements PodFiles.
+func (f *podFiles) ReadFile(name string, w io.Writer) error {
+	return f.run("read", name, "cat -- "+shellQuote(name), nil, w)
+}
+
+// WriteFile implements PodFiles.
+func (f *podFiles) WriteFile(name string, r io.Reader, perm os.FileMode) error {
+	script := fmt.Sprintf("umask %03o && cat > %s", ^perm&os.ModePerm, shellQuote(name))
+	return f.run("write", name, script, r, nil)
+}
+
+// Mkdir implements PodFiles.
+func (f *podFiles) Mkdir(name string, perm os.FileMode) error {
+	return f.run("mkdir", name, fmt.Sprintf("mkdir -m %03o -- %s", perm&os.ModePerm, shellQuote(name)), nil, nil)
+}
+
+// Remove implements PodFiles.
+func (f *podFiles) Remove(name string) error {
+	return f.run("remove", name, "rm -- "+shellQuote(name), nil, nil)
+}
+
+// RemoveDir implements PodFiles.
+func (f *podFiles) RemoveDir(name string) error {
+	return f.run("rmdir", name, "rmdir -- "+shellQuote(name), nil, nil)
+}
+
+// Rename implements PodFiles.
+func (f *podFiles) Rename(oldname, newname string) error {
+	return f.run("rename", oldname, "mv -- "+shellQuote(oldname)+" "+shellQuote(newname), nil, nil)
+}
+
+// Symlink implements PodFiles.
+func (f *podFiles) Symlink(oldname, newname string) error {
+	return f.run("symlink", newname, "ln -s -- "+shellQuote(oldname)+" "+shellQuote(newname), nil, nil)
+}
+
+// Link implements PodFiles.
+func (f *podFiles) Link(oldname, newname string) error {
+	return f.run("link", newname, "ln -- "+shellQuote(oldname)+" "+shellQuote(newname), nil, nil)
+}
+
+// Readlink implements PodFiles.
+func (f *podFiles) Readlink(name string) (string, error) {
+	var stdout bytes.Buffer
+	if err := f.run("readlink", name, "readlink -- "+shellQuote(name), nil, &stdout); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+// Chmod implements PodFiles.
+func (f *podFiles) Chmod(name string, mode os.FileMode) error {
+	return f.run("chmod", name, fmt.Sprintf("chmod %04o -- %s", mode.Perm(), shellQuote(name)), nil, nil)
+}
+
+// Truncate implements PodFiles.
+func (f *podFiles) Truncate(name string, size int64) error {
+	return f.run("truncate", name, fmt.Sprintf("truncate -s %d -- %s", size, shellQuote(name)), nil, nil)
+}
+
+// Chtimes implements PodFiles.
+func (f *podFiles) Chtimes(name string, mtime time.Time) error {
+	return f.run("chtimes", name, fmt.Sprintf("touch -m -d @%d -- %s", mtime.Unix(), shellQuote(name)), nil, nil)
+}
+
+// Runs the script with /bin/sh as the user, converting the errors to
+// *os.PathError.
+func (f *podFiles) run(op, name, script string, stdin io.Reader, stdout io.Writer) error {
+	execOpts := &corev1.PodExecOptions{
+		Container: f.pod.Spec.Containers[0].Name,
+		Command:   []string{"su", f.user, "-s", "/bin/sh", "-c", script},
+		Stdin:     stdin != nil,
+		Stdout:    stdout != nil,
+		Stderr:    true,
+		TTY:       false,
+	}
+
+	var stderr bytes.Buffer
+	err := f.executor.Stream(context.Background(), f.pod, execOpts, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: &stderr,
+		Tty:    false,
+	})
+	if err == nil {
+		return nil
+	}
+
+	var exitErr exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	msg := strings.TrimSpace(stderr.String())
+	switch {
+	case strings.Contains(msg, "No such file or directory"):
+		err = os.ErrNotExist
+	case strings.Contains(msg, "Permission denied"), strings.Contains(msg, "Operation not permitted"):
+		err = os.ErrPermission
+	case strings.Contains(msg, "File exists"):
+		err = os.ErrExist
+	case msg != "":
+		err = errors.New(msg)
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// Quotes s to be used as a single argument in a shell script.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fileInfo implements os.FileInfo for the files in the Pod.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() any           { return nil }
+
+// Parses the output of find with fileInfoFormat.
+func parseFileInfos(data []byte) ([]os.FileInfo, error) {
+	fields := strings.Split(string(data), "\x00")
+	infos := make([]os.FileInfo, 0, len(fields)/5)
+	for i := 0; i+5 <= len(fields); i += 5 {
+		size, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		perm, err := strconv.ParseUint(fields[i+2], 8, 32)
+		if err != nil {
+			return nil, err
+		}
+		mtime, err := strconv.ParseFloat(fields[i+3], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		mode := os.FileMode(perm) & os.ModePerm
+		switch fields[i+4] {
+		case "d":
+			mode |= os.ModeDir
+		case "l":
+			mode |= os.ModeSymlink
+		case "p":
+			mode |= os.ModeNamedPipe
+		case "s":
+			mode |= os.ModeSocket
+		case "c":
+			mode |= os.ModeDevice | os.ModeCharDevice
+		case "b":
+			mode |= os.ModeDevice
+		}
+
+		infos = append(infos, &fileInfo{
+			name:    fields[i],
+			size:    size,
+			mode:    mode,
+			modTime: time.Unix(0, int64(mtime*float64(time.Second))),
+		})
+	}
+	return infos, nil
+}
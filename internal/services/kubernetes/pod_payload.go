@@ -31,6 +31,14 @@ var (
 	containerTemplate               *template.Template
 )
 
+// UsernameAnnotation holds the Unix username of the user that owns the Pod or PVC.
+const UsernameAnnotation = "boombox.ivan.vc/username"
+
+// ManagedByLabel marks the Pods created by boombox.
+const ManagedByLabel = "app.kubernetes.io/managed-by"
+
+const managedByValue = "boombox"
+
 const (
 	uid                           = "10000"
 	initialInitContainerPodScript = `
@@ -88,18 +96,19 @@ func init() {
 	}
 }
 
-func getInitialPodPayload(namespace, name, image string, pvc *corev1.PersistentVolumeClaim) *corev1.Pod {
+func getInitialPodPayload(namespace, name, username, image string, pvc *corev1.PersistentVolumeClaim, user *BoomboxUser) *corev1.Pod {
 	var tmpl bytes.Buffer
-	if err := initialInitContainerPodTemplate.Execute(&tmpl, map[string]string{"Username": name, "UID": uid}); err != nil {
+	if err := initialInitContainerPodTemplate.Execute(&tmpl, map[string]string{"Username": username, "UID": uid}); err != nil {
 		log.Error("Error executing initial pod init container template", "error", err)
 		return nil
 	}
 
 	return &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
-			Labels:    map[string]string{},
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      map[string]string{ManagedByLabel: managedByValue},
+			Annotations: map[string]string{UsernameAnnotation: username},
 		},
 		Spec: corev1.PodSpec{
 			RestartPolicy: corev1.RestartPolicyNever,
@@ -112,25 +121,26 @@ func getInitialPodPayload(namespace, name, image string, pvc *corev1.PersistentV
 					VolumeMounts:    containerVolumeMounts,
 				},
 			},
-			Containers: getContainersPayload(name, image),
+			Containers: getContainersPayload(username, image, user),
 			Volumes:    getVolumesPayload(pvc),
 		},
 	}
 
 }
 
-func getPodPayload(namespace, name, image string, pvc *corev1.PersistentVolumeClaim) *corev1.Pod {
+func getPodPayload(namespace, name, username, image string, pvc *corev1.PersistentVolumeClaim, user *BoomboxUser) *corev1.Pod {
 	var tmpl bytes.Buffer
-	if err := initContainerPodTemplate.Execute(&tmpl, map[string]string{"Username": name, "UID": uid}); err != nil {
+	if err := initContainerPodTemplate.Execute(&tmpl, map[string]string{"Username": username, "UID": uid}); err != nil {
 		log.Error("Error executing pod init container template", "error", err)
 		return nil
 	}
 
 	return &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
-			Labels:    map[string]string{},
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      map[string]string{ManagedByLabel: managedByValue},
+			Annotations: map[string]string{UsernameAnnotation: username},
 		},
 		Spec: corev1.PodSpec{
 			RestartPolicy: corev1.RestartPolicyNever,
@@ -143,19 +153,23 @@ func getPodPayload(namespace, name, image string, pvc *corev1.PersistentVolumeCl
 					VolumeMounts:    containerVolumeMounts,
 				},
 			},
-			Containers: getContainersPayload(name, image),
+			Containers: getContainersPayload(username, image, user),
 			Volumes:    getVolumesPayload(pvc),
 		},
 	}
 }
 
-func getContainersPayload(name, image string) []corev1.Container {
+func getContainersPayload(username, image string, user *BoomboxUser) []corev1.Container {
 	var tmpl bytes.Buffer
-	if err := containerTemplate.Execute(&tmpl, map[string]string{"Username": name, "UID": uid}); err != nil {
+	if err := containerTemplate.Execute(&tmpl, map[string]string{"Username": username, "UID": uid}); err != nil {
 		log.Error("Error executing pod init container template", "error", err)
 		return []corev1.Container{}
 	}
 	truePtr := true
+	var resources corev1.ResourceRequirements
+	if user != nil {
+		resources = user.Spec.Resources
+	}
 
 	return []corev1.Container{
 		{
@@ -165,6 +179,7 @@ func getContainersPayload(name, image string) []corev1.Container {
 			TTY:          true,
 			Args:         []string{"/bin/sh", "-c", tmpl.String()},
 			VolumeMounts: containerVolumeMounts,
+			Resources:    resources,
 			ReadinessProbe: &corev1.Probe{
 				TimeoutSeconds:   1,
 				FailureThreshold: 60,
@@ -0,0 +1,76 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodStartupError is returned by WaitForPodInitContainer when the Pod can't
+// start, i.e., its image can't be pulled, or it can't be scheduled. The error
+// is meant to be shown to the user.
+type PodStartupError struct {
+	Pod *corev1.Pod
+	// Reason is the reason from the Pod status, i.e., ImagePullBackOff.
+	Reason  string
+	message string
+}
+
+func (e *PodStartupError) Error() string {
+	return e.message
+}
+
+// Returns why the Pod can't start, or nil if it's still starting, or it
+// started.
+func podStartupError(pod *corev1.Pod) *PodStartupError {
+	newError := func(reason, format string, args ...any) *PodStartupError {
+		return &PodStartupError{Pod: pod, Reason: reason, message: fmt.Sprintf(format, args...)}
+	}
+
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			waiting := status.State.Waiting
+			if waiting == nil {
+				continue
+			}
+			switch waiting.Reason {
+			case "ErrImagePull", "ImagePullBackOff":
+				return newError(waiting.Reason, "can't pull the image %q%s", status.Image, details(waiting.Message))
+			case "CrashLoopBackOff":
+				return newError(waiting.Reason, "the container %q keeps crashing%s", status.Name, exitDetails(status.LastTerminationState.Terminated))
+			}
+		}
+	}
+	for _, status := range pod.Status.InitContainerStatuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return newError(terminated.Reason, "the container %q failed setting up the box%s", status.Name, exitDetails(terminated))
+		}
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason == corev1.PodReasonUnschedulable {
+			return newError(cond.Reason, "the box can't be scheduled%s", details(cond.Message))
+		}
+	}
+	if pod.Status.Phase == corev1.PodFailed {
+		reason := pod.Status.Reason
+		if reason == "" {
+			reason = string(corev1.PodFailed)
+		}
+		return newError(reason, "the box failed%s", details(pod.Status.Message))
+	}
+	return nil
+}
+
+func details(message string) string {
+	if message == "" {
+		return ""
+	}
+	return ": " + message
+}
+
+func exitDetails(terminated *corev1.ContainerStateTerminated) string {
+	if terminated == nil {
+		return ""
+	}
+	return fmt.Sprintf(", it exited with status %d", terminated.ExitCode)
+}
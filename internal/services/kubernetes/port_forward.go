@@ -0,0 +1,106 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PodConn is a connection to a port in a box, opened with DialPod.
+type PodConn interface {
+	io.ReadWriteCloser
+	// CloseWrite signals the box that no more data will be written.
+	CloseWrite() error
+}
+
+// podConn is a connection to a port in a Pod, through the port-forward
+// subresource.
+type podConn struct {
+	conn   httpstream.Connection
+	data   httpstream.Stream
+	errors chan error
+}
+
+// DialPod opens a connection to a port in the Pod, through the port-forward
+// subresource.
+func (c *Client) DialPod(pod *corev1.Pod, port uint16) (PodConn, error) {
+	if c.config == nil {
+		return nil, ErrNoConfig
+	}
+	transport, upgrader, err := spdy.RoundTripperFor(c.config)
+	if err != nil {
+		return nil, err
+	}
+	req := c.CoreV1().RESTClient().Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+	conn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header{}
+	headers.Set(corev1.StreamType, corev1.StreamTypeError)
+	headers.Set(corev1.PortHeader, strconv.Itoa(int(port)))
+	headers.Set(corev1.PortForwardRequestIDHeader, "0")
+	errorStream, err := conn.CreateStream(headers)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Nothing is written to the error stream.
+	errorStream.Close()
+
+	errors := make(chan error, 1)
+	go func() {
+		message, err := io.ReadAll(errorStream)
+		switch {
+		case err != nil:
+			errors <- err
+		case len(message) > 0:
+			errors <- fmt.Errorf("forwarding to port %d: %s", port, message)
+		}
+		close(errors)
+	}()
+
+	headers.Set(corev1.StreamType, corev1.StreamTypeData)
+	data, err := conn.CreateStream(headers)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &podConn{conn: conn, data: data, errors: errors}, nil
+}
+
+// Read reads from the Pod port.
+func (p *podConn) Read(b []byte) (int, error) {
+	return p.data.Read(b)
+}
+
+// Write writes to the Pod port.
+func (p *podConn) Write(b []byte) (int, error) {
+	return p.data.Write(b)
+}
+
+// CloseWrite signals the Pod that no more data will be written.
+func (p *podConn) CloseWrite() error {
+	return p.data.Close()
+}
+
+// Close closes the connection, and returns the error reported by the
+// Kubernetes API, if any.
+func (p *podConn) Close() error {
+	p.data.Reset()
+	p.conn.Close()
+	return <-p.errors
+}
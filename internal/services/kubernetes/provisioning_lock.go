@@ -0,0 +1,193 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// How long the lock is valid without being renewed.
+	provisioningLockDuration = 30 * time.Second
+	// How often to retry acquiring a lock held by another session.
+	provisioningLockRetry = time.Second
+	// The name prefix of the provisioning Leases, followed by the user's
+	// resource name.
+	provisioningLockPrefix = "boombox-provision-"
+)
+
+// ProvisioningLock serializes the provisioning of a user's box across
+// sessions, and replicas.
+type ProvisioningLock interface {
+	// Release releases the lock, so other sessions can provision the user's
+	// resources.
+	Release()
+}
+
+// leaseLock is a ProvisioningLock held in a Lease, to serialize the
+// provisioning of a user's PVC and Pod across sessions and replicas. It's
+// renewed until it's released.
+type leaseLock struct {
+	client *Client
+	name   string
+	holder string
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// ErrProvisioningLockTimeout is returned when another session holds the
+// provisioning lock for longer than the timeout.
+var ErrProvisioningLockTimeout = fmt.Errorf("timed out waiting for the box to be provisioned by another session")
+
+// AcquireProvisioningLock blocks until the holder (i.e., the replica and
+// session) gets the provisioning lock for the user's resource name, for up to
+// timeout. The lock is released with Release, or when ctx is done.
+func (c *Client) AcquireProvisioningLock(ctx context.Context, name, holder string, timeout time.Duration) (ProvisioningLock, error) {
+	l := &leaseLock{
+		client: c,
+		name:   provisioningLockPrefix + name,
+		holder: holder,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	deadline := time.After(timeout)
+	for {
+		acquired, err := l.tryAcquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			go l.renew(ctx)
+			return l, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			return nil, ErrProvisioningLockTimeout
+		case <-time.After(provisioningLockRetry):
+		}
+	}
+}
+
+// Release implements ProvisioningLock.
+func (l *leaseLock) Release() {
+	select {
+	case <-l.stop:
+	default:
+		close(l.stop)
+	}
+	<-l.done
+}
+
+// Creates the Lease, or takes it over if it expired. It returns false if
+// another holder has it.
+func (l *leaseLock) tryAcquire(ctx context.Context) (bool, error) {
+	leases := l.client.CoordinationV1().Leases(l.client.namespace)
+	now := metav1.NewMicroTime(time.Now())
+	duration := int32(provisioningLockDuration.Seconds())
+
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: l.name, Namespace: l.client.namespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.holder,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if holder := lease.Spec.HolderIdentity; holder != nil && *holder != "" && *holder != l.holder && !leaseExpired(lease) {
+		return false, nil
+	}
+	lease.Spec.HolderIdentity = &l.holder
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if errors.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Renews the Lease until the lock is released, or ctx is done, and then
+// deletes it.
+func (l *leaseLock) renew(ctx context.Context) {
+	defer close(l.done)
+	ticker := time.NewTicker(provisioningLockDuration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			l.delete()
+			return
+		case <-ctx.Done():
+			l.delete()
+			return
+		case <-ticker.C:
+			lease, err := l.get()
+			if err != nil || lease == nil {
+				log.Error("Lost provisioning lock", "lease", l.name, "error", err)
+				return
+			}
+			now := metav1.NewMicroTime(time.Now())
+			lease.Spec.RenewTime = &now
+			if _, err := l.client.CoordinationV1().Leases(l.client.namespace).Update(context.Background(), lease, metav1.UpdateOptions{}); err != nil {
+				log.Error("Error renewing provisioning lock", "lease", l.name, "error", err)
+			}
+		}
+	}
+}
+
+// Deletes the Lease, if it's still held by this lock.
+func (l *leaseLock) delete() {
+	lease, err := l.get()
+	if err != nil || lease == nil {
+		return
+	}
+	err = l.client.CoordinationV1().Leases(l.client.namespace).Delete(context.Background(), l.name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+		log.Error("Error releasing provisioning lock", "lease", l.name, "error", err)
+	}
+}
+
+// Returns the Lease if it's held by this lock, or nil.
+func (l *leaseLock) get() (*coordinationv1.Lease, error) {
+	lease, err := l.client.CoordinationV1().Leases(l.client.namespace).Get(context.Background(), l.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.holder {
+		return nil, nil
+	}
+	return lease, nil
+}
+
+func leaseExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expiry)
+}
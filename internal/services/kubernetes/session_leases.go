@@ -0,0 +1,118 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SessionLeasePrefix is the prefix of the Pod annotations that hold the
+// session leases, followed by the session ID.
+const SessionLeasePrefix = "session.boombox.ivan.vc/"
+
+// The maximum length of the name part of an annotation key.
+const maxAnnotationNameLength = 63
+
+// SessionLease is held by a server replica on the Pod of a session, while the
+// session is alive. The replica renews it periodically.
+type SessionLease struct {
+	Replica   string    `json:"replica"`
+	RenewedAt time.Time `json:"renewedAt"`
+}
+
+// RenewSessionLeases sets the replica's leases for the session IDs on the
+// Pod. It's a no-op if the Pod doesn't exist.
+func (c *Client) RenewSessionLeases(name, replica string, ids []string) error {
+	value, err := json.Marshal(SessionLease{Replica: replica, RenewedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	annotations := make(map[string]*string, len(ids))
+	for _, id := range ids {
+		v := string(value)
+		annotations[SessionLeaseKey(id)] = &v
+	}
+	return c.patchPodAnnotations(name, annotations)
+}
+
+// ReleaseSessionLease removes the lease for the session ID from the Pod. It's
+// a no-op if the Pod doesn't exist.
+func (c *Client) ReleaseSessionLease(name, id string) error {
+	return c.patchPodAnnotations(name, map[string]*string{SessionLeaseKey(id): nil})
+}
+
+// LiveSessionLeases returns the number of the Pod's session leases renewed
+// within the ttl.
+func LiveSessionLeases(pod *corev1.Pod, ttl time.Duration) int {
+	live := 0
+	for key, value := range pod.Annotations {
+		if !strings.HasPrefix(key, SessionLeasePrefix) {
+			continue
+		}
+		var lease SessionLease
+		if err := json.Unmarshal([]byte(value), &lease); err != nil {
+			continue
+		}
+		if time.Since(lease.RenewedAt) < ttl {
+			live++
+		}
+	}
+	return live
+}
+
+// ListManagedPods returns the Pods created by boombox.
+func (c *Client) ListManagedPods() ([]corev1.Pod, error) {
+	list, err := c.CoreV1().Pods(c.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: ManagedByLabel + "=" + managedByValue,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// DeletePodIfUnchanged deletes the Pod, if it wasn't modified (i.e., a lease
+// was added) since it was fetched. It returns false if it wasn't deleted
+// because of that, or because it's already gone.
+func (c *Client) DeletePodIfUnchanged(pod *corev1.Pod) (bool, error) {
+	err := c.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{
+			UID:             &pod.UID,
+			ResourceVersion: &pod.ResourceVersion,
+		},
+	})
+	if errors.IsConflict(err) || errors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Merge patches the Pod annotations, a nil value removes the annotation.
+func (c *Client) patchPodAnnotations(name string, annotations map[string]*string) error {
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.CoreV1().Pods(c.namespace).Patch(context.Background(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// SessionLeaseKey returns the key of the Pod annotation that holds the lease
+// for the session ID.
+func SessionLeaseKey(id string) string {
+	if len(id) > maxAnnotationNameLength {
+		id = id[:maxAnnotationNameLength]
+	}
+	return SessionLeasePrefix + id
+}
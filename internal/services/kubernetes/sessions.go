@@ -0,0 +1,146 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The container's own terminal, which is not a user session.
+const containerTTY = "pts/0"
+
+// Lists the processes, and the last access time of the terminals, which is
+// the last time there was input.
+const listShellSessionsScript = "ps -e -o pid=,sid=,pgid=,tpgid=,etimes=,tty=,args=; echo; stat -c '%n %X' /dev/pts/[0-9]* 2>/dev/null"
+
+// Session is a user's session in the Pod. It's either a tmux session, or a
+// login shell in a terminal.
+type Session struct {
+	// ID is the tmux session name, or the session ID of the login shell.
+	ID       string
+	TTY      string
+	Started  time.Time
+	Activity time.Time
+	// Command is the foreground command in the session.
+	Command string
+	// Attached is the number of clients attached to a tmux session.
+	Attached int
+	// Multiplexed sessions run in tmux, and can be joined.
+	Multiplexed bool
+}
+
+// ListSessions returns the user's sessions in the Pod, the most recently
+// active first. With multiplexer, they are the tmux sessions, otherwise the
+// login shells.
+func (c *Client) ListSessions(pod *corev1.Pod, user string, multiplexer bool) ([]Session, error) {
+	var sessions []Session
+	var err error
+	if multiplexer {
+		sessions, err = ListMultiplexerSessions(c, pod, user)
+	} else {
+		sessions, err = c.listShellSessions(pod)
+	}
+	if err != nil {
+		return nil, err
+	}
+	SortSessions(sessions)
+	return sessions, nil
+}
+
+// SortSessions sorts the sessions, the most recently active first.
+func SortSessions(sessions []Session) {
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Activity.After(sessions[j].Activity)
+	})
+}
+
+// KillSession ends the user's session in the Pod.
+func (c *Client) KillSession(pod *corev1.Pod, user string, session Session) error {
+	if session.Multiplexed {
+		return KillMultiplexerSession(c, pod, user, session.ID)
+	}
+	if _, err := strconv.Atoi(session.ID); err != nil {
+		return fmt.Errorf("invalid session %q", session.ID)
+	}
+	_, err := c.execCommandInPod(pod, "pkill", "-HUP", "-s", session.ID)
+	return err
+}
+
+// Returns the login shells in the Pod's terminals.
+func (c *Client) listShellSessions(pod *corev1.Pod) ([]Session, error) {
+	stdout, err := c.execCommandInPod(pod, "/bin/sh", "-c", listShellSessionsScript)
+	if err != nil {
+		return nil, err
+	}
+	processes, ttys, _ := strings.Cut(stdout, "\n\n")
+	return parseShellSessions(processes, ttys, time.Now()), nil
+}
+
+type process struct {
+	pid, sid, pgid, tpgid string
+	elapsed               int64
+	tty, args             string
+}
+
+// Parses the output of listShellSessionsScript. A session is a session
+// leader with a terminal, and its command is the terminal's foreground
+// process group leader.
+func parseShellSessions(processes, ttys string, now time.Time) []Session {
+	var procs []process
+	for _, line := range strings.Split(processes, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 7 {
+			continue
+		}
+		elapsed, _ := strconv.ParseInt(fields[4], 10, 64)
+		procs = append(procs, process{
+			pid:     fields[0],
+			sid:     fields[1],
+			pgid:    fields[2],
+			tpgid:   fields[3],
+			elapsed: elapsed,
+			tty:     fields[5],
+			args:    strings.Join(fields[6:], " "),
+		})
+	}
+
+	activity := make(map[string]time.Time)
+	for _, line := range strings.Split(ttys, "\n") {
+		name, atime, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		if t, err := strconv.ParseInt(atime, 10, 64); err == nil {
+			activity[strings.TrimPrefix(name, "/dev/")] = time.Unix(t, 0)
+		}
+	}
+
+	var sessions []Session
+	for _, p := range procs {
+		if p.pid != p.sid || !strings.HasPrefix(p.tty, "pts/") || p.tty == containerTTY {
+			continue
+		}
+		session := Session{
+			ID:       p.sid,
+			TTY:      p.tty,
+			Started:  now.Add(-time.Duration(p.elapsed) * time.Second),
+			Activity: activity[p.tty],
+			Command:  p.args,
+		}
+		if session.Activity.IsZero() {
+			session.Activity = session.Started
+		}
+		for _, fg := range procs {
+			if fg.tty == p.tty && fg.pid == fg.tpgid {
+				session.Command = fg.args
+				break
+			}
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
@@ -0,0 +1,128 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// BoomboxUserResource is the GroupVersionResource of the BoomboxUser custom
+// resource.
+var BoomboxUserResource = schema.GroupVersionResource{
+	Group:    "boombox.ivan.vc",
+	Version:  "v1alpha1",
+	Resource: "boomboxusers",
+}
+
+// BoomboxUser is the custom resource that holds a user's access and Pod
+// settings.
+type BoomboxUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BoomboxUserSpec `json:"spec,omitempty"`
+}
+
+// BoomboxUserSpec is the specification of a BoomboxUser.
+type BoomboxUserSpec struct {
+	// PublicKeys in the authorized_keys format.
+	PublicKeys []string `json:"publicKeys,omitempty"`
+	// Image overrides the configured container image.
+	Image string `json:"image,omitempty"`
+	// AllowedImages restricts the images the user can run, if not empty.
+	AllowedImages []string `json:"allowedImages,omitempty"`
+	// PVCSize overrides the configured size for the user PVC.
+	PVCSize string `json:"pvcSize,omitempty"`
+	// Resources for the user's container.
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// PortForwarding overrides the configured port forwarding policy.
+	PortForwarding *PortForwardingPolicy `json:"portForwarding,omitempty"`
+	// Watchers are the usernames allowed to watch the user's sessions.
+	Watchers []string `json:"watchers,omitempty"`
+	// PreviewViewers are the usernames allowed to view the user's private
+	// previews.
+	PreviewViewers []string `json:"previewViewers,omitempty"`
+	// Recording opts the user in to session recording.
+	Recording bool `json:"recording,omitempty"`
+	// Disabled users are not allowed to log in.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// PortForwardingPolicy holds the destinations a user can forward ports to.
+type PortForwardingPolicy struct {
+	// Pod allows forwarding to the ports of the user's Pod.
+	Pod bool `json:"pod,omitempty"`
+	// AllowedHosts are the host patterns, with an optional port (i.e.,
+	// *.svc.cluster.local:80), allowed as destinations.
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+}
+
+// UserRegistry keeps an informer backed cache of the BoomboxUsers in the
+// namespace.
+type UserRegistry struct {
+	factory  dynamicinformer.DynamicSharedInformerFactory
+	informer cache.SharedIndexInformer
+	lister   cache.GenericNamespaceLister
+}
+
+// NewUserRegistry returns a new UserRegistry, it needs to be started with
+// Start.
+func (c *Client) NewUserRegistry() (*UserRegistry, error) {
+	if c.config == nil {
+		return nil, ErrNoConfig
+	}
+	dc, err := dynamic.NewForConfig(c.config)
+	if err != nil {
+		return nil, err
+	}
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dc, 10*time.Minute, c.namespace, nil)
+	informer := factory.ForResource(BoomboxUserResource)
+	return &UserRegistry{
+		factory:  factory,
+		informer: informer.Informer(),
+		lister:   informer.Lister().ByNamespace(c.namespace),
+	}, nil
+}
+
+// Start runs the informer until ctx is done, and waits for the cache to sync.
+func (r *UserRegistry) Start(ctx context.Context) error {
+	r.factory.Start(ctx.Done())
+	syncCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), r.informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for the %s cache to sync", BoomboxUserResource.Resource)
+	}
+	log.Info("BoomboxUser registry synced")
+	return nil
+}
+
+// Get returns the BoomboxUser with the given name, or nil if it doesn't exist.
+func (r *UserRegistry) Get(name string) (*BoomboxUser, error) {
+	obj, err := r.lister.Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+	user := new(BoomboxUser)
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
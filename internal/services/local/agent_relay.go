@@ -0,0 +1,68 @@
+package local
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/charmbracelet/log"
+)
+
+// agentRelay listens on the session's agent socket in the host, and relays
+// its connections to the user's SSH agent.
+type agentRelay struct {
+	user   string
+	socket string
+	open   func() (io.ReadWriteCloser, error)
+}
+
+// Run implements kubernetes.AgentRelay.
+func (r *agentRelay) Run(ctx context.Context, ready chan<- struct{}) error {
+	if err := os.MkdirAll(filepath.Dir(r.socket), 0o700); err != nil {
+		return err
+	}
+	os.Remove(r.socket)
+	listener, err := net.Listen("unix", r.socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(r.socket)
+	if err := os.Chmod(r.socket, 0o600); err != nil {
+		listener.Close()
+		return err
+	}
+	close(ready)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go r.relay(conn)
+	}
+}
+
+// Relays the connection to a new connection to the user's agent, until either
+// of them is closed. If the agent can't be opened, the connection is closed.
+func (r *agentRelay) relay(conn net.Conn) {
+	defer conn.Close()
+	agent, err := r.open()
+	if err != nil {
+		log.Error("Error opening the agent", "user", r.user, "error", err)
+		return
+	}
+	go func() {
+		io.Copy(agent, conn)
+		agent.Close()
+	}()
+	io.Copy(conn, agent)
+}
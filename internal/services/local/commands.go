@@ -0,0 +1,92 @@
+package local
+
+import (
+	"context"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/remotecommand"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// attachment runs the user's login shell with a PTY, as a session of the Pod.
+// It implements tea.ExecCommand.
+type attachment struct {
+	exec    *executor
+	pod     *corev1.Pod
+	user    string
+	command string
+	env     []string
+
+	stdin  io.Reader
+	stdout io.Writer
+
+	recorders []k8s.Recorder
+	sizeChan  k8s.SizeChan
+}
+
+// SetStdin implements tea.ExecCommand.
+func (a *attachment) SetStdin(reader io.Reader) {
+	a.stdin = reader
+}
+
+// SetStdout implements tea.ExecCommand.
+func (a *attachment) SetStdout(writer io.Writer) {
+	a.stdout = writer
+}
+
+// SetStderr implements tea.ExecCommand. The PTY writes stderr to stdout.
+func (a *attachment) SetStderr(io.Writer) {}
+
+// Run implements tea.ExecCommand.
+func (a *attachment) Run() error {
+	var args []string
+	if a.command != "" {
+		args = []string{"-c", a.command}
+	}
+	stdin, stdout, sizeQueue := k8s.RecordStreams(a.recorders, a.stdin, a.stdout, a.sizeChan)
+	return a.exec.run(context.Background(), a.pod.Name, a.user, a.env, args, true, remotecommand.StreamOptions{
+		Stdin:             stdin,
+		Stdout:            stdout,
+		Tty:               true,
+		TerminalSizeQueue: sizeQueue,
+	})
+}
+
+// command runs a command with the user's login shell, without a PTY.
+type command struct {
+	exec    *executor
+	pod     *corev1.Pod
+	user    string
+	command string
+	env     []string
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// Run implements kubernetes.Command.
+func (c *command) Run(ctx context.Context) error {
+	return c.exec.run(ctx, c.pod.Name, c.user, c.env, []string{"-c", c.command}, false, remotecommand.StreamOptions{
+		Stdin:  c.stdin,
+		Stdout: c.stdout,
+		Stderr: c.stderr,
+	})
+}
+
+// logTail sends the log of the box's provisioning, which is done by the time
+// the Pod is created, so there's nothing to follow.
+type logTail struct {
+	lines     []string
+	linesChan chan string
+}
+
+// Run implements kubernetes.LogTail.
+func (lt *logTail) Run(string) error {
+	for _, line := range lt.lines {
+		lt.linesChan <- line
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// executor runs the users' shells as local processes, in their home
+// directories, and keeps track of the interactive ones as sessions.
+type executor struct {
+	homes string
+
+	mu       sync.Mutex
+	sessions map[int]*session
+}
+
+// session is a login shell with a PTY.
+type session struct {
+	pod     string
+	cmd     *exec.Cmd
+	tty     string
+	started time.Time
+
+	mu       sync.Mutex
+	activity time.Time
+	stdout   io.Writer
+}
+
+func newExecutor(homes string) *executor {
+	return &executor{homes: homes, sessions: make(map[int]*session)}
+}
+
+// Runs the user's login shell, $SHELL (or /bin/sh), with the args in the
+// user's home directory, and the env variables in the NAME=value form. With
+// tty, the shell gets a PTY, and it's a session of the Pod. If the shell exits
+// with a non-zero status, it returns an exec.CodeExitError, like the exec
+// subresource.
+func (e *executor) run(ctx context.Context, pod, user string, env, args []string, tty bool, streams remotecommand.StreamOptions) error {
+	home, err := e.home(user)
+	if err != nil {
+		return err
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell, append([]string{"-l"}, args...)...)
+	cmd.Dir = home
+	cmd.Env = append([]string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + home,
+		"USER=" + user,
+		"LOGNAME=" + user,
+		"SHELL=" + shell,
+		// Keeps the tmux sessions of each user apart.
+		"TMUX_TMPDIR=" + home,
+	}, env...)
+
+	if tty {
+		err = e.runTTY(ctx, pod, cmd, streams)
+	} else {
+		err = runCommand(ctx, cmd, streams)
+	}
+	return exitError(err)
+}
+
+// Returns the user's home directory, creating it if needed.
+func (e *executor) home(user string) (string, error) {
+	if user == "" || user != filepath.Base(user) || strings.HasPrefix(user, ".") {
+		return "", fmt.Errorf("invalid username %q", user)
+	}
+	home := e.homePath(user)
+	return home, os.MkdirAll(home, 0o750)
+}
+
+// Returns the path of the user's home directory.
+func (e *executor) homePath(user string) string {
+	return filepath.Join(e.homes, user)
+}
+
+// Runs the command with a PTY, copying the streams until it exits.
+func (e *executor) runTTY(ctx context.Context, pod string, cmd *exec.Cmd, streams remotecommand.StreamOptions) error {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return err
+	}
+	defer ptmx.Close()
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	err = cmd.Start()
+	tty.Close()
+	if err != nil {
+		return err
+	}
+
+	s := &session{
+		pod:      pod,
+		cmd:      cmd,
+		tty:      strings.TrimPrefix(tty.Name(), "/dev/"),
+		started:  time.Now(),
+		activity: time.Now(),
+		stdout:   streams.Stdout,
+	}
+	e.mu.Lock()
+	e.sessions[cmd.Process.Pid] = s
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.sessions, cmd.Process.Pid)
+		e.mu.Unlock()
+	}()
+
+	if streams.TerminalSizeQueue != nil {
+		go func() {
+			for size := streams.TerminalSizeQueue.Next(); size != nil; size = streams.TerminalSizeQueue.Next() {
+				pty.Setsize(ptmx, &pty.Winsize{Rows: size.Height, Cols: size.Width})
+			}
+		}()
+	}
+	if streams.Stdin != nil {
+		go io.Copy(ptmx, io.TeeReader(streams.Stdin, activityWriter{s}))
+	}
+	output := make(chan struct{})
+	go func() {
+		defer close(output)
+		// It ends with EIO once the shell, and its children, exit.
+		io.Copy(s, ptmx)
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.hangUp()
+		case <-done:
+		}
+	}()
+	err = cmd.Wait()
+	// Background processes may keep the terminal open.
+	select {
+	case <-output:
+	case <-time.After(time.Second):
+	}
+	return err
+}
+
+// Runs the command without a PTY until it exits, or ctx is done.
+func runCommand(ctx context.Context, cmd *exec.Cmd, streams remotecommand.StreamOptions) error {
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = streams.Stdin, streams.Stdout, streams.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	return cmd.Wait()
+}
+
+// Converts the exit status of the process to the error returned by the exec
+// subresource.
+func exitError(err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	code := exitErr.ExitCode()
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		code = 128 + int(status.Signal())
+	}
+	return utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code %d", code), Code: code}
+}
+
+// Returns the login shells in the Pod, as Sessions.
+func (e *executor) listSessions(pod string) []k8s.Session {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var sessions []k8s.Session
+	for pid, s := range e.sessions {
+		if s.pod != pod {
+			continue
+		}
+		s.mu.Lock()
+		sessions = append(sessions, k8s.Session{
+			ID:       strconv.Itoa(pid),
+			TTY:      s.tty,
+			Started:  s.started,
+			Activity: s.activity,
+			Command:  filepath.Base(s.cmd.Path),
+		})
+		s.mu.Unlock()
+	}
+	return sessions
+}
+
+// Ends the login shell with the ID in the Pod.
+func (e *executor) killSession(pod, id string) error {
+	pid, _ := strconv.Atoi(id)
+	e.mu.Lock()
+	s, ok := e.sessions[pid]
+	e.mu.Unlock()
+	if !ok || s.pod != pod {
+		return fmt.Errorf("there is no session %q", id)
+	}
+	s.hangUp()
+	return nil
+}
+
+// Ends the login shells in the Pod.
+func (e *executor) killSessions(pod string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range e.sessions {
+		if s.pod == pod {
+			s.hangUp()
+		}
+	}
+}
+
+// Writes the message to the login shells in the Pod, like wall(1).
+func (e *executor) wall(pod, message string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range e.sessions {
+		if s.pod == pod {
+			s.Write([]byte("\r\n" + message + "\r\n"))
+		}
+	}
+}
+
+// Write writes the shell output to the user's terminal.
+func (s *session) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stdout == nil {
+		return len(p), nil
+	}
+	return s.stdout.Write(p)
+}
+
+// activityWriter records the user's input as activity in the session.
+type activityWriter struct {
+	s *session
+}
+
+func (w activityWriter) Write(p []byte) (int, error) {
+	w.s.mu.Lock()
+	w.s.activity = time.Now()
+	w.s.mu.Unlock()
+	return len(p), nil
+}
+
+// Sends SIGHUP to the shell's process group, as when the terminal is closed.
+func (s *session) hangUp() {
+	syscall.Kill(-s.cmd.Process.Pid, syscall.SIGHUP)
+}
@@ -0,0 +1,161 @@
+package local
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// files implements kubernetes.PodFiles with the files in the host. The paths
+// in the box are the paths in the host, so the home is the user's home
+// directory in the Backend's homes.
+type files struct {
+	home string
+}
+
+// Home implements kubernetes.PodFiles.
+func (f *files) Home() string {
+	return f.home
+}
+
+// Stat implements kubernetes.PodFiles.
+func (f *files) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Lstat implements kubernetes.PodFiles.
+func (f *files) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// ReadDir implements kubernetes.PodFiles.
+func (f *files) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Walk implements kubernetes.PodFiles.
+func (f *files) Walk(name string) ([]string, []os.FileInfo, error) {
+	var paths []string
+	var infos []os.FileInfo
+	err := filepath.Walk(name, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		infos = append(infos, info)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return paths, infos, nil
+}
+
+// Glob implements kubernetes.PodFiles.
+func (f *files) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+// ReadFile implements kubernetes.PodFiles.
+func (f *files) ReadFile(name string, w io.Writer) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// WriteFile implements kubernetes.PodFiles.
+func (f *files) WriteFile(name string, r io.Reader, perm os.FileMode) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Mkdir implements kubernetes.PodFiles.
+func (f *files) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(name, perm)
+}
+
+// Remove implements kubernetes.PodFiles. Like rm, it doesn't remove
+// directories.
+func (f *files) Remove(name string) error {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &os.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Remove(name)
+}
+
+// RemoveDir implements kubernetes.PodFiles.
+func (f *files) RemoveDir(name string) error {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: "rmdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Remove(name)
+}
+
+// Rename implements kubernetes.PodFiles.
+func (f *files) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+// Symlink implements kubernetes.PodFiles.
+func (f *files) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+// Link implements kubernetes.PodFiles.
+func (f *files) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+// Readlink implements kubernetes.PodFiles.
+func (f *files) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+// Chmod implements kubernetes.PodFiles.
+func (f *files) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode.Perm())
+}
+
+// Truncate implements kubernetes.PodFiles.
+func (f *files) Truncate(name string, size int64) error {
+	return os.Truncate(name, size)
+}
+
+// Chtimes implements kubernetes.PodFiles. The access time is set to the
+// modification time.
+func (f *files) Chtimes(name string, mtime time.Time) error {
+	return os.Chtimes(name, mtime, mtime)
+}
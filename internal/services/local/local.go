@@ -0,0 +1,347 @@
+// Package local runs the users' boxes as processes in the host, with a home
+// directory per user, to try boombox without a Kubernetes cluster. The boxes
+// are not isolated from each other, or from the host: the shells run as the
+// server's user, the files are the host's files, and the ports are the host's
+// ports.
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// Backend is a kubernetes.Backend that keeps the Pods and PVCs of the boxes in
+// memory, and runs the commands in them as local processes. A PVC is the
+// user's home directory, and a Pod is running once it's created.
+type Backend struct {
+	namespace string
+	exec      *executor
+
+	mu      sync.Mutex
+	version int
+	pods    map[string]*corev1.Pod
+	pvcs    map[string]*corev1.PersistentVolumeClaim
+	// The provisioning locks, closed when they are released.
+	locks map[string]chan struct{}
+}
+
+var _ k8s.Backend = (*Backend)(nil)
+
+// New returns a new Backend, with the users' home directories in homes.
+func New(homes, namespace string) (*Backend, error) {
+	homes, err := filepath.Abs(homes)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(homes, 0o750); err != nil {
+		return nil, err
+	}
+	return &Backend{
+		namespace: namespace,
+		exec:      newExecutor(homes),
+		pods:      make(map[string]*corev1.Pod),
+		pvcs:      make(map[string]*corev1.PersistentVolumeClaim),
+		locks:     make(map[string]chan struct{}),
+	}, nil
+}
+
+// GetPod implements kubernetes.Backend.
+func (b *Backend) GetPod(name string) (*corev1.Pod, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if pod, ok := b.pods[name]; ok {
+		return pod.DeepCopy(), nil
+	}
+	return nil, nil
+}
+
+// GetPVC implements kubernetes.Backend.
+func (b *Backend) GetPVC(name string) (*corev1.PersistentVolumeClaim, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if pvc, ok := b.pvcs[name]; ok {
+		return pvc.DeepCopy(), nil
+	}
+	return nil, nil
+}
+
+// CreatePVC implements kubernetes.Backend. It creates the user's home
+// directory, the size is ignored.
+func (b *Backend) CreatePVC(name, username, size string) (*corev1.PersistentVolumeClaim, error) {
+	if _, err := b.exec.home(username); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if pvc, ok := b.pvcs[name]; ok {
+		return pvc.DeepCopy(), nil
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: b.objectMeta(name, username),
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+	}
+	b.pvcs[name] = pvc
+	return pvc.DeepCopy(), nil
+}
+
+// WaitForPVC implements kubernetes.Backend. The PVCs are bound once created.
+func (b *Backend) WaitForPVC(pvc *corev1.PersistentVolumeClaim) error {
+	return nil
+}
+
+// CreatePod implements kubernetes.Backend. The image, and the BoomboxUser's
+// resources, are ignored.
+func (b *Backend) CreatePod(name, username, image string, pvc *corev1.PersistentVolumeClaim, user *k8s.BoomboxUser) (*corev1.Pod, error) {
+	if _, err := b.exec.home(username); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if pod, ok := b.pods[name]; ok {
+		return pod.DeepCopy(), nil
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: b.objectMeta(name, username),
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "boombox", Image: image}}},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	b.pods[name] = pod
+	return pod.DeepCopy(), nil
+}
+
+// CreateInitialPod implements kubernetes.Backend. The home directory is
+// created with the PVC, so there's nothing to provision.
+func (b *Backend) CreateInitialPod(name, username, image string, pvc *corev1.PersistentVolumeClaim, user *k8s.BoomboxUser) (*corev1.Pod, error) {
+	return b.CreatePod(name, username, image, pvc, user)
+}
+
+// WaitForPodInitContainer implements kubernetes.Backend. The Pods are ready
+// once created.
+func (b *Backend) WaitForPodInitContainer(pod *corev1.Pod) (k8s.PodStatus, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.pods[pod.Name]; !ok {
+		return k8s.PodStatusUnknown, fmt.Errorf("the box was deleted while starting, try again in a moment")
+	}
+	return k8s.PodStatusReady, nil
+}
+
+// DeletePod implements kubernetes.Backend. It ends the Pod's sessions.
+func (b *Backend) DeletePod(pod *corev1.Pod) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.pods, pod.Name)
+	b.exec.killSessions(pod.Name)
+	return nil
+}
+
+// DeletePodIfUnchanged implements kubernetes.Backend.
+func (b *Backend) DeletePodIfUnchanged(pod *corev1.Pod) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current, ok := b.pods[pod.Name]
+	if !ok || current.UID != pod.UID || current.ResourceVersion != pod.ResourceVersion {
+		return false, nil
+	}
+	delete(b.pods, pod.Name)
+	b.exec.killSessions(pod.Name)
+	return true, nil
+}
+
+// ListManagedPods implements kubernetes.Backend.
+func (b *Backend) ListManagedPods() ([]corev1.Pod, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pods := make([]corev1.Pod, 0, len(b.pods))
+	for _, pod := range b.pods {
+		pods = append(pods, *pod.DeepCopy())
+	}
+	return pods, nil
+}
+
+// RenewSessionLeases implements kubernetes.Backend.
+func (b *Backend) RenewSessionLeases(name, replica string, ids []string) error {
+	value, err := json.Marshal(k8s.SessionLease{Replica: replica, RenewedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pod, ok := b.pods[name]
+	if !ok {
+		return nil
+	}
+	for _, id := range ids {
+		pod.Annotations[k8s.SessionLeaseKey(id)] = string(value)
+	}
+	b.update(pod)
+	return nil
+}
+
+// ReleaseSessionLease implements kubernetes.Backend.
+func (b *Backend) ReleaseSessionLease(name, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pod, ok := b.pods[name]
+	if !ok {
+		return nil
+	}
+	delete(pod.Annotations, k8s.SessionLeaseKey(id))
+	b.update(pod)
+	return nil
+}
+
+// AcquireProvisioningLock implements kubernetes.Backend. The lock is held in
+// memory, as there's a single server.
+func (b *Backend) AcquireProvisioningLock(ctx context.Context, name, holder string, timeout time.Duration) (k8s.ProvisioningLock, error) {
+	deadline := time.After(timeout)
+	for {
+		b.mu.Lock()
+		held, ok := b.locks[name]
+		if !ok {
+			l := &lock{b: b, name: name, released: make(chan struct{})}
+			b.locks[name] = l.released
+			b.mu.Unlock()
+			go func() {
+				select {
+				case <-ctx.Done():
+					l.Release()
+				case <-l.released:
+				}
+			}()
+			return l, nil
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			return nil, k8s.ErrProvisioningLockTimeout
+		case <-held:
+		}
+	}
+}
+
+// ListSessions implements kubernetes.Backend. Without multiplexer, the
+// sessions are the login shells with a PTY run by the Backend.
+func (b *Backend) ListSessions(pod *corev1.Pod, user string, multiplexer bool) ([]k8s.Session, error) {
+	if multiplexer {
+		sessions, err := k8s.ListMultiplexerSessions(b, pod, user)
+		if err != nil {
+			return nil, err
+		}
+		k8s.SortSessions(sessions)
+		return sessions, nil
+	}
+	sessions := b.exec.listSessions(pod.Name)
+	k8s.SortSessions(sessions)
+	return sessions, nil
+}
+
+// KillSession implements kubernetes.Backend.
+func (b *Backend) KillSession(pod *corev1.Pod, user string, session k8s.Session) error {
+	if session.Multiplexed {
+		return k8s.KillMultiplexerSession(b, pod, user, session.ID)
+	}
+	return b.exec.killSession(pod.Name, session.ID)
+}
+
+// SendWallToPod implements kubernetes.Backend.
+func (b *Backend) SendWallToPod(pod *corev1.Pod, message string) error {
+	b.exec.wall(pod.Name, message)
+	return nil
+}
+
+// NewAttachment implements kubernetes.Backend.
+func (b *Backend) NewAttachment(pod *corev1.Pod, user, command string, env []string, recorders []k8s.Recorder, sizeChan k8s.SizeChan) tea.ExecCommand {
+	return &attachment{exec: b.exec, pod: pod, user: user, command: command, env: env, recorders: recorders, sizeChan: sizeChan}
+}
+
+// NewCommand implements kubernetes.Backend.
+func (b *Backend) NewCommand(pod *corev1.Pod, user, cmd string, env []string, stdin io.Reader, stdout, stderr io.Writer) k8s.Command {
+	return &command{exec: b.exec, pod: pod, user: user, command: cmd, env: env, stdin: stdin, stdout: stdout, stderr: stderr}
+}
+
+// NewLogTail implements kubernetes.Backend. There's no init container, the
+// log only tells where the home directory is.
+func (b *Backend) NewLogTail(pod *corev1.Pod, linesChan chan string) k8s.LogTail {
+	lines := []string{"The box runs in the host, with the home directory in " + b.exec.homePath(pod.Annotations[k8s.UsernameAnnotation])}
+	return &logTail{lines: lines, linesChan: linesChan}
+}
+
+// NewAgentRelay implements kubernetes.Backend. The socket is in the host.
+func (b *Backend) NewAgentRelay(pod *corev1.Pod, user, socket string, open func() (io.ReadWriteCloser, error)) k8s.AgentRelay {
+	return &agentRelay{user: user, socket: socket, open: open}
+}
+
+// NewPodFiles implements kubernetes.Backend. The files are the host's, the
+// user's home is the home directory in homes.
+func (b *Backend) NewPodFiles(pod *corev1.Pod, user string) k8s.PodFiles {
+	return &files{home: b.exec.homePath(user)}
+}
+
+// DialPod implements kubernetes.Backend. The boxes share the host's network,
+// so it connects to the port in the host's loopback address.
+func (b *Backend) DialPod(pod *corev1.Pod, port uint16) (k8s.PodConn, error) {
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.TCPConn), nil
+}
+
+// Returns the metadata of a new object, owned by the username.
+func (b *Backend) objectMeta(name, username string) metav1.ObjectMeta {
+	b.version++
+	return metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         b.namespace,
+		UID:               types.UID(fmt.Sprintf("%s-%d", name, b.version)),
+		ResourceVersion:   strconv.Itoa(b.version),
+		CreationTimestamp: metav1.Now(),
+		Annotations:       map[string]string{k8s.UsernameAnnotation: username},
+	}
+}
+
+// Records a change in the Pod, so DeletePodIfUnchanged sees it.
+func (b *Backend) update(pod *corev1.Pod) {
+	b.version++
+	pod.ResourceVersion = strconv.Itoa(b.version)
+}
+
+// lock is a ProvisioningLock held in the Backend.
+type lock struct {
+	b        *Backend
+	name     string
+	once     sync.Once
+	released chan struct{}
+}
+
+// Release implements kubernetes.ProvisioningLock.
+func (l *lock) Release() {
+	l.once.Do(func() {
+		l.b.mu.Lock()
+		delete(l.b.locks, l.name)
+		l.b.mu.Unlock()
+		close(l.released)
+	})
+}
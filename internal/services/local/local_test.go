@@ -0,0 +1,92 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/exec"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+func TestBackendRunsCommandsInTheUserHome(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	homes := t.TempDir()
+	b, err := New(homes, "boombox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pvc, err := b.CreatePVC("alice", "alice", "1Gi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod, err := b.CreateInitialPod("alice", "alice", "ubuntu", pvc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := b.WaitForPodInitContainer(pod)
+	if err != nil || status != k8s.PodStatusReady {
+		t.Fatalf("got status %v, %v, want ready", status, err)
+	}
+
+	var stdout bytes.Buffer
+	err = b.NewCommand(pod, "alice", `echo "$HOME $GREETING"; exit 3`, []string{"GREETING=hi"}, nil, &stdout, nil).Run(context.Background())
+	var exitErr exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 3 {
+		t.Errorf("got error %v, want exit status 3", err)
+	}
+	if got, want := strings.TrimSpace(stdout.String()), filepath.Join(homes, "alice")+" hi"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+
+	files := b.NewPodFiles(pod, "alice")
+	name := filepath.Join(files.Home(), "hello.txt")
+	if err := files.WriteFile(name, strings.NewReader("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var contents bytes.Buffer
+	if err := files.ReadFile(name, &contents); err != nil || contents.String() != "hello" {
+		t.Errorf("got contents %q, error %v, want hello", contents.String(), err)
+	}
+	if _, err := files.Stat(filepath.Join(files.Home(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got error %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestBackendKeepsPodsWithNewLeases(t *testing.T) {
+	b, err := New(t.TempDir(), "boombox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod, err := b.CreatePod("alice", "alice", "ubuntu", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RenewSessionLeases("alice", "replica", []string{"session"}); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := b.DeletePodIfUnchanged(pod); deleted || err != nil {
+		t.Fatalf("got deleted %v, error %v, want the Pod kept", deleted, err)
+	}
+
+	pod, err = b.GetPod("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live := k8s.LiveSessionLeases(pod, time.Minute); live != 1 {
+		t.Errorf("got %d live leases, want 1", live)
+	}
+	if deleted, err := b.DeletePodIfUnchanged(pod); !deleted || err != nil {
+		t.Fatalf("got deleted %v, error %v, want the Pod deleted", deleted, err)
+	}
+	if pod, _ := b.GetPod("alice"); pod != nil {
+		t.Error("got the Pod, want it deleted")
+	}
+}
@@ -0,0 +1,119 @@
+// Package timeout ends the interactive sessions that are idle, or that reach
+// their maximum duration.
+package timeout
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How often the watchdog checks the deadlines.
+const checkInterval = time.Second
+
+// Watchdog ends a session when there's no input for the idle timeout, or when
+// it reaches the maximum duration. The user is warned before. It implements
+// the kubernetes.Recorder interface, so it gets the session input.
+type Watchdog struct {
+	idleTimeout time.Duration
+	maxDuration time.Duration
+	warning     time.Duration
+	warn        func(msg string)
+	expire      func(reason string)
+	start       time.Time
+	done        chan struct{}
+	closeOnce   sync.Once
+
+	mu         sync.Mutex
+	lastInput  time.Time
+	warnedIdle bool
+	warnedMax  bool
+}
+
+// New returns a new running *Watchdog. A zero idleTimeout or maxDuration
+// disables it. warn is called the warning duration before the session ends,
+// and expire when it has to end.
+func New(idleTimeout, maxDuration, warning time.Duration, warn func(msg string), expire func(reason string)) *Watchdog {
+	now := time.Now()
+	w := &Watchdog{
+		idleTimeout: idleTimeout,
+		maxDuration: maxDuration,
+		warning:     warning,
+		warn:        warn,
+		expire:      expire,
+		start:       now,
+		lastInput:   now,
+		done:        make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Input implements kubernetes.Recorder. It resets the idle timeout.
+func (w *Watchdog) Input(p []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastInput = time.Now()
+	w.warnedIdle = false
+}
+
+// Output implements kubernetes.Recorder.
+func (w *Watchdog) Output(p []byte) {}
+
+// Resize implements kubernetes.Recorder.
+func (w *Watchdog) Resize(width, height uint16) {}
+
+// Close implements kubernetes.Recorder. It stops the watchdog.
+func (w *Watchdog) Close() error {
+	w.closeOnce.Do(func() { close(w.done) })
+	return nil
+}
+
+func (w *Watchdog) run() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			warnings, reason := w.check(now)
+			for _, msg := range warnings {
+				w.warn(msg)
+			}
+			if reason != "" {
+				w.expire(reason)
+				return
+			}
+		}
+	}
+}
+
+// Returns the warnings for the deadlines that are close, and the reason to end
+// the session if one passed.
+func (w *Watchdog) check(now time.Time) (warnings []string, reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.maxDuration > 0 {
+		left := w.start.Add(w.maxDuration).Sub(now)
+		if left <= 0 {
+			return nil, fmt.Sprintf("the session reached the maximum duration of %s", w.maxDuration)
+		}
+		if left <= w.warning && !w.warnedMax {
+			w.warnedMax = true
+			warnings = append(warnings, fmt.Sprintf("This session will end in %s, as it reaches the maximum duration of %s.", left.Round(time.Second), w.maxDuration))
+		}
+	}
+	if w.idleTimeout > 0 {
+		left := w.lastInput.Add(w.idleTimeout).Sub(now)
+		if left <= 0 {
+			return nil, fmt.Sprintf("the session was idle for %s", w.idleTimeout)
+		}
+		if left <= w.warning && !w.warnedIdle {
+			w.warnedIdle = true
+			warnings = append(warnings, fmt.Sprintf("This session will end in %s due to inactivity, press any key to keep it open.", left.Round(time.Second)))
+		}
+	}
+	return warnings, ""
+}
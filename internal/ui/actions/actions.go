@@ -1,13 +1,25 @@
 package actions
 
-import k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+import (
+	"context"
+	"sync"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
 
 // Actions is the bridge between the UI and the services.
 type Actions struct {
-	k8sClient *k8s.Client
+	k8sClient k8s.Backend
+	ctx       context.Context
+	// holder identifies the session in the provisioning lock.
+	holder string
+
+	lockMu sync.Mutex
+	lock   k8s.ProvisioningLock
 }
 
-// Returns a new Actions instance.
-func New(client *k8s.Client) *Actions {
-	return &Actions{client}
+// Returns a new Actions instance, for the session with the context ctx, and
+// identified by holder across replicas.
+func New(ctx context.Context, client k8s.Backend, holder string) *Actions {
+	return &Actions{k8sClient: client, ctx: ctx, holder: holder}
 }
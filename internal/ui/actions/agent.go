@@ -0,0 +1,23 @@
+package actions
+
+import (
+	"context"
+	"io"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ForwardAgent relays the session's agent socket in the Pod to the user's SSH
+// agent, until ctx is done. Errors are logged, as the session can go on
+// without the agent.
+func (a *Actions) ForwardAgent(ctx context.Context, pod *corev1.Pod, user, socket string, open func() (io.ReadWriteCloser, error)) tea.Cmd {
+	return func() tea.Msg {
+		ready := make(chan struct{})
+		if err := a.k8sClient.NewAgentRelay(pod, user, socket, open).Run(ctx, ready); err != nil {
+			log.Error("Error forwarding agent", "user", user, "error", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,21 @@
+package actions
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/ivanvc/boombox/internal/ui/common/state"
+)
+
+// Attach tells the UI to attach to the Pod, joining the multiplexer session,
+// or opening a new shell if session is empty.
+func Attach(pod *corev1.Pod, session string, readOnly bool) tea.Cmd {
+	return func() tea.Msg {
+		return state.StateChangedMsg{
+			State:    state.AttachedToPod,
+			Pod:      pod,
+			Session:  session,
+			ReadOnly: readOnly,
+		}
+	}
+}
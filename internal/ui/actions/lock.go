@@ -0,0 +1,43 @@
+package actions
+
+import (
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// How long to wait for another session to provision the user's Pod.
+const provisioningLockTimeout = 5 * time.Minute
+
+// Acquires the lock to provision the user's PVC and Pod, so only one session,
+// in any replica, creates them. It's released once the Pod is created, or
+// when the session ends.
+func (a *Actions) lockProvisioning(name string) error {
+	a.lockMu.Lock()
+	locked := a.lock != nil
+	a.lockMu.Unlock()
+	if locked {
+		return nil
+	}
+
+	log.Debug("Acquiring provisioning lock", "name", name, "holder", a.holder)
+	lock, err := a.k8sClient.AcquireProvisioningLock(a.ctx, name, a.holder, provisioningLockTimeout)
+	if err != nil {
+		return err
+	}
+
+	a.lockMu.Lock()
+	defer a.lockMu.Unlock()
+	a.lock = lock
+	return nil
+}
+
+// Releases the provisioning lock, if the session holds it.
+func (a *Actions) unlockProvisioning() {
+	a.lockMu.Lock()
+	defer a.lockMu.Unlock()
+	if a.lock != nil {
+		a.lock.Release()
+		a.lock = nil
+	}
+}
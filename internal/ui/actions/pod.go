@@ -1,20 +1,30 @@
 package actions
 
 import (
+	"errors"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/log"
 
 	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
 	"github.com/ivanvc/boombox/internal/ui/common/state"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/exec"
 )
 
-// FetchPod tries to see if there's a Pod with that name in the cluster.
+// FetchPod tries to see if there's a Pod with that name in the cluster. If
+// there's none, it takes the provisioning lock, and checks again, as another
+// session may have been creating it.
 func (a *Actions) FetchPod(name string) tea.Cmd {
 	return func() tea.Msg {
 		pod, err := a.k8sClient.GetPod(name)
+		if err == nil && pod == nil {
+			if err = a.lockProvisioning(name); err == nil {
+				pod, err = a.k8sClient.GetPod(name)
+			}
+		}
 		if err != nil {
-			log.Error("Error fetching pod", err)
+			log.Error("Error fetching pod", "error", err)
 			return state.StateChangedMsg{
 				State: state.Error,
 				Error: err,
@@ -23,6 +33,7 @@ func (a *Actions) FetchPod(name string) tea.Cmd {
 		if pod == nil {
 			return state.StateChangedMsg{State: state.FetchingPVC}
 		}
+		a.unlockProvisioning()
 		if pod.Status.Phase == corev1.PodRunning {
 			return state.StateChangedMsg{
 				State: state.PodRunning,
@@ -37,9 +48,10 @@ func (a *Actions) FetchPod(name string) tea.Cmd {
 }
 
 // CreateInitialPod creates a new Pod with the init container that provisions the user home.
-func (a *Actions) CreateInitialPod(name, image string, pvc *corev1.PersistentVolumeClaim) tea.Cmd {
+func (a *Actions) CreateInitialPod(name, username, image string, pvc *corev1.PersistentVolumeClaim, user *k8s.BoomboxUser) tea.Cmd {
 	return func() tea.Msg {
-		pod, err := a.k8sClient.CreateInitialPod(name, image, pvc)
+		pod, err := a.k8sClient.CreateInitialPod(name, username, image, pvc, user)
+		a.unlockProvisioning()
 		if err != nil {
 			log.Error("Error creating pod", err)
 			return state.StateChangedMsg{
@@ -54,10 +66,11 @@ func (a *Actions) CreateInitialPod(name, image string, pvc *corev1.PersistentVol
 	}
 }
 
-// CreatePod creates a new Pod with the given name, container image, and pvc.
-func (a *Actions) CreatePod(name, image string, pvc *corev1.PersistentVolumeClaim) tea.Cmd {
+// CreatePod creates a new Pod with the given name, for the Unix username, with the container image, pvc, and user settings.
+func (a *Actions) CreatePod(name, username, image string, pvc *corev1.PersistentVolumeClaim, user *k8s.BoomboxUser) tea.Cmd {
 	return func() tea.Msg {
-		pod, err := a.k8sClient.CreatePod(name, image, pvc)
+		pod, err := a.k8sClient.CreatePod(name, username, image, pvc, user)
+		a.unlockProvisioning()
 		if err != nil {
 			log.Error("Error creating pod", err)
 			return state.StateChangedMsg{
@@ -123,28 +136,73 @@ func (a *Actions) TailInitContainerLogs(pod *corev1.Pod, linesChan chan string)
 	}
 }
 
-// Attach to a running Pod.
-func (a *Actions) AttachToPod(pod *corev1.Pod, user string, sizeChan k8s.SizeChan) tea.Cmd {
-	attachment := a.k8sClient.NewAttachment(pod, user, sizeChan)
+// The exit code when the attachment fails for other reasons than the shell
+// exiting.
+const attachErrorExitCode = 255
+
+// Attach to a running Pod, running the command (or an interactive shell if
+// it's empty) with the env variables in the user's login shell. The recorders
+// are closed when the attachment finishes.
+func (a *Actions) AttachToPod(pod *corev1.Pod, user, command string, env []string, recorders []k8s.Recorder, sizeChan k8s.SizeChan) tea.Cmd {
+	attachment := a.k8sClient.NewAttachment(pod, user, command, env, recorders, sizeChan)
 	return tea.Exec(attachment, func(err error) tea.Msg {
-		if conn, err := a.k8sClient.GetActivePTYs(pod); err != nil {
+		for _, r := range recorders {
+			if err := r.Close(); err != nil {
+				log.Error("Error closing recorder", "error", err)
+			}
+		}
+
+		exitCode := 0
+		var exitErr exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitStatus()
+		} else if err != nil {
+			log.Error("Error attaching to pod", "error", err)
+			exitCode = attachErrorExitCode
+		}
+
+		return state.StateChangedMsg{
+			State:    state.PodTerminated,
+			Pod:      pod,
+			ExitCode: exitCode,
+		}
+	})
+}
+
+// FetchSessions lists the user's sessions in the Pod.
+func (a *Actions) FetchSessions(pod *corev1.Pod, user string, multiplexer bool) tea.Cmd {
+	return func() tea.Msg {
+		return a.fetchSessions(pod, user, multiplexer)
+	}
+}
+
+// KillSession ends the user's session in the Pod, and lists the remaining
+// ones.
+func (a *Actions) KillSession(pod *corev1.Pod, user string, session k8s.Session, multiplexer bool) tea.Cmd {
+	return func() tea.Msg {
+		if err := a.k8sClient.KillSession(pod, user, session); err != nil {
+			log.Error("Error killing session", "error", err)
 			return state.StateChangedMsg{
 				State: state.Error,
 				Error: err,
 			}
-		} else if conn == 1 {
-			log.Debugf("Last PTY from Pod %q, deleting", pod.Name)
-			if err := a.k8sClient.DeletePod(pod); err != nil {
-				log.Errorf("Error deleting pod %T", err)
-				return state.StateChangedMsg{
-					State: state.Error,
-					Error: err,
-				}
-			}
 		}
+		return a.fetchSessions(pod, user, multiplexer)
+	}
+}
+
+func (a *Actions) fetchSessions(pod *corev1.Pod, user string, multiplexer bool) tea.Msg {
+	sessions, err := a.k8sClient.ListSessions(pod, user, multiplexer)
+	if err != nil {
+		log.Error("Error listing sessions", "error", err)
 		return state.StateChangedMsg{
-			State: state.PodTerminated,
-			Pod:   pod,
+			State: state.Error,
+			Error: err,
 		}
-	})
+	}
+	return state.StateChangedMsg{
+		State:    state.SelectingSession,
+		Pod:      pod,
+		Sessions: sessions,
+	}
 }
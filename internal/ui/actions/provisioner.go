@@ -0,0 +1,107 @@
+package actions
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	corev1 "k8s.io/api/core/v1"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+	"github.com/ivanvc/boombox/internal/ui/common/state"
+)
+
+// Provisioner runs the same actions as the UI to fetch or create the user's
+// PVC and Pod, but without the UI. It's used by sessions that don't have a
+// terminal.
+type Provisioner struct {
+	*Actions
+
+	Name     string
+	Username string
+	Image    string
+	PVCSize  string
+	Account  *k8s.BoomboxUser
+
+	// OnStateChange, if set, is called on every state change.
+	OnStateChange func(state.State)
+	// OnLogLine, if set, is called with every log line of the init container.
+	OnLogLine func(string)
+}
+
+// NewProvisioner returns a new Provisioner.
+func (a *Actions) NewProvisioner(name, username, image, pvcSize string, account *k8s.BoomboxUser) *Provisioner {
+	return &Provisioner{
+		Actions:  a,
+		Name:     name,
+		Username: username,
+		Image:    image,
+		PVCSize:  pvcSize,
+		Account:  account,
+	}
+}
+
+// Run provisions the user's Pod, and returns it once it's running.
+func (p *Provisioner) Run() (*corev1.Pod, error) {
+	var createdPVC bool
+	cmd := p.FetchPod(p.Name)
+	for cmd != nil {
+		msg, ok := cmd().(state.StateChangedMsg)
+		if !ok {
+			return nil, fmt.Errorf("pod %q didn't become ready", p.Name)
+		}
+		if p.OnStateChange != nil {
+			p.OnStateChange(msg.State)
+		}
+
+		switch msg.State {
+		case state.FetchingPVC:
+			cmd = p.FetchPVC(p.Name)
+		case state.CreatingPVC:
+			createdPVC = true
+			cmd = p.CreatePVC(p.Name, p.Username, p.PVCSize)
+		case state.WaitingForPVC:
+			cmd = p.WaitForPVC(msg.PVC)
+		case state.CreatingPod:
+			if createdPVC {
+				cmd = p.CreateInitialPod(p.Name, p.Username, p.Image, msg.PVC, p.Account)
+			} else {
+				cmd = p.CreatePod(p.Name, p.Username, p.Image, msg.PVC, p.Account)
+			}
+		case state.WaitingForPod:
+			cmd = p.WaitForPodInitContainer(msg.Pod)
+		case state.WaitingForInitContainer:
+			cmd = p.tailInitContainerLogs(msg.Pod)
+		case state.PodRunning:
+			return msg.Pod, nil
+		case state.Error:
+			return nil, msg.Error
+		default:
+			return nil, fmt.Errorf("unexpected state %d while provisioning pod %q", msg.State, p.Name)
+		}
+	}
+	return nil, fmt.Errorf("pod %q didn't become ready", p.Name)
+}
+
+// Tails the init container logs, sending them to OnLogLine.
+func (p *Provisioner) tailInitContainerLogs(pod *corev1.Pod) tea.Cmd {
+	linesChan := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case line := <-linesChan:
+				if p.OnLogLine != nil {
+					p.OnLogLine(line)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	cmd := p.TailInitContainerLogs(pod, linesChan)
+	return func() tea.Msg {
+		defer close(done)
+		return cmd()
+	}
+}
@@ -29,10 +29,10 @@ func (a *Actions) FetchPVC(name string) tea.Cmd {
 	}
 }
 
-// CreatePVC creates a new PersistentVolumeClaim with a given name and size in the cluster.
-func (a *Actions) CreatePVC(name, size string) tea.Cmd {
+// CreatePVC creates a new PersistentVolumeClaim with a given name and size in the cluster, for the user.
+func (a *Actions) CreatePVC(name, username, size string) tea.Cmd {
 	return func() tea.Msg {
-		pvc, err := a.k8sClient.CreatePVC(name, size)
+		pvc, err := a.k8sClient.CreatePVC(name, username, size)
 		if err != nil {
 			log.Error("Error creating PVC", err)
 			return state.StateChangedMsg{
@@ -0,0 +1,35 @@
+package common
+
+import (
+	"io"
+
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// The SSH channel type to connect to the client's agent.
+const agentChannelType = "auth-agent@openssh.com"
+
+// AgentForwarding returns true if the server allows agent forwarding, and the
+// client requested it for the session (i.e., ssh -A).
+func (c *Common) AgentForwarding() bool {
+	return c.Config.AgentForwarding && ssh.AgentRequested(c.Session)
+}
+
+// AgentSocket returns the path of the session's agent socket in the Pod.
+func (c *Common) AgentSocket() string {
+	return k8s.AgentSocket(c.Session.Context().SessionID())
+}
+
+// OpenAgent returns a new connection to the client's SSH agent.
+func (c *Common) OpenAgent() (io.ReadWriteCloser, error) {
+	conn := c.Session.Context().Value(ssh.ContextKeyConn).(gossh.Conn)
+	ch, reqs, err := conn.OpenChannel(agentChannelType, nil)
+	if err != nil {
+		return nil, err
+	}
+	go gossh.DiscardRequests(reqs)
+	return ch, nil
+}
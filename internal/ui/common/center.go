@@ -13,3 +13,14 @@ func (c *Common) RenderCentered(text string) string {
 		),
 	)
 }
+
+// RenderCenteredWithLogo renders the logo above the text, centered. If they
+// don't fit in the terminal, the logo is left out, as the terminal would cut
+// the top of the screen.
+func (c *Common) RenderCenteredWithLogo(logo, text string) string {
+	withLogo := logo + "\n\n" + text
+	if lipgloss.Height(withLogo) <= c.Height && lipgloss.Width(withLogo) <= c.Width {
+		return c.RenderCentered(withLogo)
+	}
+	return c.RenderCentered(text)
+}
@@ -5,20 +5,34 @@ import (
 	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
 
 	"github.com/ivanvc/boombox/internal/config"
+	"github.com/ivanvc/boombox/internal/identity"
 	"github.com/ivanvc/boombox/internal/ui/actions"
 	"github.com/ivanvc/boombox/internal/ui/common/state"
+	"github.com/ivanvc/boombox/internal/watch"
 )
 
 // Common holds elements used by all the UI components and views.
 type Common struct {
 	Session ssh.Session
 	User    string
+	// ResourceName is the name for the user's Kubernetes resources.
+	ResourceName string
+	// Account is the user's BoomboxUser, nil if the user registry is disabled.
+	Account *k8s.BoomboxUser
+	// Extensions from the user certificate, if the user logged in with one.
+	Extensions map[string]string
+	// Selector from the SSH login (i.e., alice+resume).
+	Selector identity.Selector
 
 	Width  int
 	Height int
 
-	Client  *k8s.Client
+	Client  k8s.Backend
 	Config  *config.Config
 	Actions *actions.Actions
+	// Watches holds the sessions that can be watched.
+	Watches *watch.Hub
 	State   state.State
+	// ExitCode is sent to the client when the session ends.
+	ExitCode int
 }
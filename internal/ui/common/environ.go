@@ -0,0 +1,47 @@
+package common
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Environ returns the environment variables sent by the client (i.e., with
+// SendEnv or SetEnv) that are in the allow list, in the NAME=value form. TERM
+// is taken from the client's PTY, if the session has one, and SSH_AUTH_SOCK is
+// the session's agent socket, if it forwards the agent.
+func (c *Common) Environ() []string {
+	var env []string
+	for _, v := range c.Session.Environ() {
+		name, _, _ := strings.Cut(v, "=")
+		if name == "TERM" || name == "SSH_AUTH_SOCK" {
+			continue
+		}
+		if !envNameRegexp.MatchString(name) || !c.envAllowed(name) {
+			log.Debug("Denied environment variable", "user", c.User, "name", name)
+			continue
+		}
+		env = append(env, v)
+	}
+	if pty, _, active := c.Session.Pty(); active && pty.Term != "" {
+		env = append(env, "TERM="+pty.Term)
+	}
+	if c.AgentForwarding() {
+		env = append(env, "SSH_AUTH_SOCK="+c.AgentSocket())
+	}
+	return env
+}
+
+// Returns true if the name matches a pattern in the allow list.
+func (c *Common) envAllowed(name string) bool {
+	for _, pattern := range c.Config.EnvAllowList {
+		if ok, _ := path.Match(strings.TrimSpace(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
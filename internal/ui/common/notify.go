@@ -0,0 +1,8 @@
+package common
+
+import "fmt"
+
+// Notify writes a message from boombox in the user's terminal.
+func (c *Common) Notify(msg string) {
+	fmt.Fprintf(c.Session.Stderr(), "\r\n[boombox] %s\r\n", msg)
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/ivanvc/boombox/internal/recording"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// The environment variable a client sets to opt in to recording (i.e., ssh -o
+// SetEnv=BOOMBOX_RECORD=1).
+const recordEnv = "BOOMBOX_RECORD"
+
+// Recording returns true if the user's interactive sessions are recorded.
+// With the opt-in mode, users opt in with their BoomboxUser, or by sending
+// BOOMBOX_RECORD.
+func (c *Common) Recording() bool {
+	switch c.Config.Recording {
+	case recording.ModeEnforced:
+		return true
+	case recording.ModeOptIn:
+		if c.Account != nil && c.Account.Spec.Recording {
+			return true
+		}
+		for _, v := range c.Session.Environ() {
+			if name, value, _ := strings.Cut(v, "="); name == recordEnv {
+				b, _ := strconv.ParseBool(value)
+				return b
+			}
+		}
+	}
+	return false
+}
+
+// NewRecorder returns a new recorder for an interactive session, or nil if the
+// session is not recorded. Recordings are stored in the recording path, by
+// user and SSH session ID.
+func (c *Common) NewRecorder() (k8s.Recorder, error) {
+	if !c.Recording() {
+		return nil, nil
+	}
+
+	path := recording.Path(c.Config.RecordingPath, c.ResourceName, c.Session.Context().SessionID(), time.Now())
+	env := make(map[string]string)
+	if pty, _, active := c.Session.Pty(); active && pty.Term != "" {
+		env["TERM"] = pty.Term
+	}
+	rec, err := recording.NewAsciicast(path, c.Width, c.Height, c.User, env)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Recording session", "user", c.User, "path", path)
+	return rec, nil
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/ivanvc/boombox/internal/auth"
+)
+
+// ContainerImage returns the container image for the user's Pod. The user
+// certificate can override the one in the BoomboxUser, which overrides the
+// configured one. If the BoomboxUser has allowed images, the image has to be
+// one of them.
+func (c *Common) ContainerImage() (string, error) {
+	image := c.Config.ContainerImage
+	if c.Account != nil && c.Account.Spec.Image != "" {
+		image = c.Account.Spec.Image
+	}
+	if ext := c.Extensions[auth.ExtensionImage]; ext != "" {
+		image = ext
+	}
+
+	if c.Account != nil && len(c.Account.Spec.AllowedImages) > 0 {
+		for _, allowed := range c.Account.Spec.AllowedImages {
+			if image == allowed {
+				return image, nil
+			}
+		}
+		return "", fmt.Errorf("image %q is not allowed for user %q", image, c.User)
+	}
+	return image, nil
+}
+
+// PVCSize returns the size for the user's PVC, the BoomboxUser can override the
+// configured one.
+func (c *Common) PVCSize() string {
+	if c.Account != nil && c.Account.Spec.PVCSize != "" {
+		return c.Account.Spec.PVCSize
+	}
+	return c.Config.PVCSize
+}
@@ -0,0 +1,24 @@
+package common
+
+import (
+	"errors"
+
+	"github.com/charmbracelet/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
+
+// DeleteFailedPod deletes the user's Pod if err is because it failed to start,
+// and delete-failed-pods is set, so the next login creates it again.
+func (c *Common) DeleteFailedPod(err error) {
+	var startupErr *k8s.PodStartupError
+	if !c.Config.DeleteFailedPods || !errors.As(err, &startupErr) {
+		return
+	}
+	if err := c.Client.DeletePod(startupErr.Pod); err != nil && !apierrors.IsNotFound(err) {
+		log.Error("Error deleting failed pod", "pod", startupErr.Pod.Name, "error", err)
+		return
+	}
+	log.Info("Deleted pod that failed to start", "pod", startupErr.Pod.Name, "reason", startupErr.Reason)
+}
@@ -1,6 +1,10 @@
 package state
 
-import corev1 "k8s.io/api/core/v1"
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+)
 
 // State holds the current state of the UI.
 type State int
@@ -16,6 +20,7 @@ const (
 	WaitingForInitContainer
 	PodTerminated
 	PodRunning
+	SelectingSession
 	AttachedToPod
 	Error
 )
@@ -26,6 +31,15 @@ type StateChangedMsg struct {
 	Pod   *corev1.Pod
 	PVC   *corev1.PersistentVolumeClaim
 	Error error
+	// ExitCode is the exit status of the user's shell, set with PodTerminated.
+	ExitCode int
+	// Sessions are the user's sessions in the Pod, set with SelectingSession.
+	Sessions []k8s.Session
+	// Session is the multiplexer session to join with AttachedToPod, or empty
+	// for a new shell.
+	Session string
+	// ReadOnly joins the Session read-only.
+	ReadOnly bool
 }
 
 func (s State) String() string {
@@ -43,6 +57,10 @@ func (s State) String() string {
 	case WaitingForPod:
 		return "Waiting for pod to be ready"
 	case PodRunning:
+		return "Pod is running"
+	case SelectingSession:
+		return "Listing sessions"
+	case AttachedToPod:
 		return "Attaching to pod..."
 	}
 	return ""
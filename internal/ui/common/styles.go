@@ -10,6 +10,7 @@ var (
 	LogoStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("12"))
 	LogoActivityStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("4"))
 	ErrorStyle        = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("197"))
+	RecordingStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("197"))
 
 	CheckMark = lipgloss.NewStyle().Foreground(lipgloss.Color("42")).SetString("✓")
 )
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+	"github.com/ivanvc/boombox/internal/timeout"
+)
+
+// NewWatchdog returns a watchdog that disconnects the user when the
+// interactive session is idle, or reaches its maximum duration, or nil if
+// both are disabled. With the multiplexer, it also kills the session's tmux
+// session (the session argument), unless other clients are attached to it, so
+// it doesn't keep the Pod running. The Pod is then released as with any
+// disconnection.
+func (c *Common) NewWatchdog(pod *corev1.Pod, session string) k8s.Recorder {
+	if c.Config.IdleTimeout <= 0 && c.Config.MaxSessionDuration <= 0 {
+		return nil
+	}
+	return timeout.New(c.Config.IdleTimeout, c.Config.MaxSessionDuration, c.Config.SessionTimeoutWarning, c.Notify, func(reason string) {
+		log.Info("Ending session", "user", c.User, "reason", reason)
+		c.Notify("Disconnecting, " + reason + ".")
+		if c.Config.SessionMultiplexer && session != "" {
+			c.killMultiplexerSession(pod, session)
+		}
+		c.Session.Context().Value(ssh.ContextKeyConn).(gossh.Conn).Close()
+	})
+}
+
+// Kills the tmux session, unless other clients are attached to it.
+func (c *Common) killMultiplexerSession(pod *corev1.Pod, name string) {
+	sessions, err := c.Client.ListSessions(pod, c.User, true)
+	if err != nil {
+		log.Error("Error listing sessions", "user", c.User, "error", err)
+		return
+	}
+	for _, s := range sessions {
+		if s.ID != name {
+			continue
+		}
+		if s.Attached > 1 {
+			log.Info("Keeping multiplexer session with other clients", "user", c.User, "session", name, "attached", s.Attached)
+			return
+		}
+		if err := c.Client.KillSession(pod, c.User, s); err != nil {
+			log.Error("Error killing multiplexer session", "user", c.User, "session", name, "error", err)
+		}
+		return
+	}
+}
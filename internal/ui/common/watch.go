@@ -0,0 +1,14 @@
+package common
+
+import (
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+	"github.com/ivanvc/boombox/internal/watch"
+)
+
+// PublishSession makes the user's interactive session watchable, and returns
+// the recorder that mirrors its output. Watchers joining or leaving are shown
+// in the user's terminal, and the session is redrawn with redraw when one
+// joins.
+func (c *Common) PublishSession(redraw watch.RedrawFunc) k8s.Recorder {
+	return c.Watches.Publish(c.ResourceName, c.Width, c.Height, c.Notify, redraw)
+}
@@ -2,11 +2,15 @@ package ui
 
 import (
 	"fmt"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/log"
+	"github.com/muesli/reflow/wordwrap"
+	"github.com/muesli/reflow/wrap"
 	"k8s.io/client-go/tools/remotecommand"
 
+	"github.com/ivanvc/boombox/internal/identity"
 	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
 	"github.com/ivanvc/boombox/internal/ui/actions"
 	"github.com/ivanvc/boombox/internal/ui/common"
@@ -20,8 +24,15 @@ const (
 	loadingView view = iota
 	tailView
 	completedView
+	sessionsView
 )
 
+// The exit code sent to the client when the UI shows an error.
+const errorExitCode = 1
+
+// How long to wait for the attached shell to take a new size, when redrawing.
+const redrawTimeout = time.Second
+
 // UI holds the main UI of the application.
 type UI struct {
 	common     *common.Common
@@ -30,13 +41,18 @@ type UI struct {
 	sizeChan   k8s.SizeChan
 	error      error
 	createdPVC bool
+	// pickingSession is true once the sessions view is shown.
+	pickingSession bool
+	// sessions are the user's sessions in the Pod, the last time they were
+	// listed.
+	sessions []k8s.Session
 }
 
 // New returns a new UI.
 func New(common *common.Common) *UI {
 	return &UI{
 		common:   common,
-		views:    make([]tea.Model, 3),
+		views:    make([]tea.Model, 4),
 		sizeChan: make(k8s.SizeChan, 1),
 	}
 }
@@ -47,7 +63,8 @@ func (ui *UI) Init() tea.Cmd {
 	ui.views[loadingView] = views.NewLoading(ui.common)
 	ui.views[tailView] = views.NewTail(ui.common)
 	ui.views[completedView] = views.NewCompleted(ui.common)
-	cmds := []tea.Cmd{ui.common.Actions.FetchPod(ui.common.User)}
+	ui.views[sessionsView] = views.NewSessions(ui.common)
+	cmds := []tea.Cmd{ui.common.Actions.FetchPod(ui.common.ResourceName)}
 	for _, v := range ui.views {
 		cmds = append(cmds, v.Init())
 	}
@@ -63,7 +80,7 @@ func (ui *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		ui.common.Width = msg.Width
 		ui.common.Height = msg.Height
-		if ui.common.State == state.PodRunning {
+		if ui.common.State == state.AttachedToPod {
 			ui.sizeChan <- remotecommand.TerminalSize{
 				Width:  uint16(msg.Width),
 				Height: uint16(msg.Height),
@@ -79,19 +96,25 @@ func (ui *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch msg.State {
 		case state.FetchingPod:
 			ui.activeView = loadingView
-			cmds = append(cmds, ui.common.Actions.FetchPod(ui.common.User))
+			cmds = append(cmds, ui.common.Actions.FetchPod(ui.common.ResourceName))
 		case state.FetchingPVC:
-			cmds = append(cmds, ui.common.Actions.FetchPVC(ui.common.User))
+			cmds = append(cmds, ui.common.Actions.FetchPVC(ui.common.ResourceName))
 		case state.CreatingPVC:
 			ui.createdPVC = true
-			cmds = append(cmds, ui.common.Actions.CreatePVC(ui.common.User, ui.common.Config.PVCSize))
+			cmds = append(cmds, ui.common.Actions.CreatePVC(ui.common.ResourceName, ui.common.User, ui.common.PVCSize()))
 		case state.WaitingForPVC:
 			cmds = append(cmds, ui.common.Actions.WaitForPVC(msg.PVC))
 		case state.CreatingPod:
+			image, err := ui.common.ContainerImage()
+			if err != nil {
+				ui.common.ExitCode = errorExitCode
+				ui.error = err
+				break
+			}
 			if ui.createdPVC {
-				cmds = append(cmds, ui.common.Actions.CreateInitialPod(ui.common.User, ui.common.Config.ContainerImage, msg.PVC))
+				cmds = append(cmds, ui.common.Actions.CreateInitialPod(ui.common.ResourceName, ui.common.User, image, msg.PVC, ui.common.Account))
 			} else {
-				cmds = append(cmds, ui.common.Actions.CreatePod(ui.common.User, ui.common.Config.ContainerImage, msg.PVC))
+				cmds = append(cmds, ui.common.Actions.CreatePod(ui.common.ResourceName, ui.common.User, image, msg.PVC, ui.common.Account))
 			}
 		case state.WaitingForPod:
 			cmds = append(cmds, ui.common.Actions.WaitForPodInitContainer(msg.Pod))
@@ -99,18 +122,52 @@ func (ui *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			ui.activeView = tailView
 			cmds = append(cmds, actions.StartLogTail(msg.Pod))
 		case state.PodRunning:
-			cmds = append(cmds, ui.common.Actions.AttachToPod(msg.Pod, ui.common.User, ui.sizeChan))
+			cmds = append(cmds, ui.common.Actions.FetchSessions(msg.Pod, ui.common.User, ui.common.Config.SessionMultiplexer))
+		case state.SelectingSession:
+			ui.sessions = msg.Sessions
+			cmds = append(cmds, ui.selectSession(msg))
+		case state.AttachedToPod:
+			recorder, err := ui.common.NewRecorder()
+			if err != nil {
+				log.Error("Error starting recording", "user", ui.common.User, "error", err)
+				ui.common.ExitCode = errorExitCode
+				ui.error = err
+				break
+			}
+			session := ui.multiplexerSession(msg.Session)
+			recorders := []k8s.Recorder{ui.common.PublishSession(ui.redraw)}
+			if recorder != nil {
+				recorders = append(recorders, recorder)
+			}
+			if watchdog := ui.common.NewWatchdog(msg.Pod, session); watchdog != nil {
+				recorders = append(recorders, watchdog)
+			}
+			if ui.common.AgentForwarding() {
+				cmds = append(cmds, ui.common.Actions.ForwardAgent(ui.common.Session.Context(), msg.Pod, ui.common.User, ui.common.AgentSocket(), ui.common.OpenAgent))
+			}
+			cmds = append(cmds, ui.common.Actions.AttachToPod(msg.Pod, ui.common.User, ui.shellCommand(session, msg.Session == "", msg.ReadOnly), ui.common.Environ(), recorders, ui.sizeChan))
 			ui.sizeChan <- remotecommand.TerminalSize{
 				Width:  uint16(ui.common.Width),
 				Height: uint16(ui.common.Height),
 			}
 		case state.PodTerminated:
+			ui.common.ExitCode = msg.ExitCode
 			ui.activeView = completedView
 		case state.Error:
+			ui.common.ExitCode = errorExitCode
 			ui.error = msg.Error
+			err := msg.Error
+			cmds = append(cmds, func() tea.Msg {
+				ui.common.DeleteFailedPod(err)
+				return nil
+			})
 		}
 	}
 	for i, v := range ui.views {
+		// Only the active view handles the keys.
+		if _, ok := msg.(tea.KeyMsg); ok && view(i) != ui.activeView {
+			continue
+		}
 		m, cmd := v.Update(msg)
 		ui.views[i] = m
 		if cmd != nil {
@@ -121,15 +178,105 @@ func (ui *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return ui, tea.Batch(cmds...)
 }
 
+// Redraws the attached shell, for a new watcher. The terminal is resized, as
+// the programs (i.e., tmux, or an editor) redraw their screen when it changes.
+func (ui *UI) redraw(width, height int) {
+	if height < 2 {
+		return
+	}
+	for _, h := range []int{height - 1, height} {
+		select {
+		case ui.sizeChan <- remotecommand.TerminalSize{Width: uint16(width), Height: uint16(h)}:
+		case <-ui.common.Session.Context().Done():
+			return
+		case <-time.After(redrawTimeout):
+			return
+		}
+	}
+}
+
+// Returns the command for the user's shell. With the multiplexer, it creates
+// the session, or joins it.
+func (ui *UI) shellCommand(session string, create, readOnly bool) string {
+	if !ui.common.Config.SessionMultiplexer {
+		return ""
+	}
+	if create {
+		return k8s.NewMultiplexerSessionCommand(session)
+	}
+	return k8s.AttachMultiplexerSessionCommand(session, readOnly)
+}
+
+// Returns the multiplexer session to join, or the name for a new one if
+// session is empty. Without the multiplexer, it returns an empty string.
+func (ui *UI) multiplexerSession(session string) string {
+	if !ui.common.Config.SessionMultiplexer || session != "" {
+		return session
+	}
+	return k8s.NewMultiplexerSessionName(ui.sessions)
+}
+
+// Decides what to do with the user's sessions in the Pod. Without sessions,
+// it opens a new shell. Otherwise, the user picks one, unless the login
+// selects the session to resume.
+func (ui *UI) selectSession(msg state.StateChangedMsg) tea.Cmd {
+	if ui.pickingSession {
+		return nil
+	}
+	if ui.common.Selector.Kind == identity.SelectorResume {
+		session, err := resumableSession(msg.Sessions, ui.common.Selector.Arg)
+		if err != nil {
+			return stateError(err)
+		}
+		if session != "" {
+			return actions.Attach(msg.Pod, session, false)
+		}
+	} else if len(msg.Sessions) == 0 {
+		return actions.Attach(msg.Pod, "", false)
+	}
+	ui.pickingSession = true
+	ui.activeView = sessionsView
+	return nil
+}
+
+// Returns the session to resume, or an empty string if the user has to pick
+// one. If name is not empty, it's the session to resume.
+func resumableSession(sessions []k8s.Session, name string) (string, error) {
+	if len(sessions) == 0 {
+		return "", fmt.Errorf("there are no sessions to resume")
+	}
+	if name != "" {
+		for _, s := range sessions {
+			if s.ID == name {
+				return name, nil
+			}
+		}
+		return "", fmt.Errorf("there is no session %q to resume", name)
+	}
+	if len(sessions) == 1 {
+		return sessions[0].ID, nil
+	}
+	return "", nil
+}
+
+func stateError(err error) tea.Cmd {
+	return func() tea.Msg {
+		return state.StateChangedMsg{
+			State: state.Error,
+			Error: err,
+		}
+	}
+}
+
 // View implements tea.Model.
 func (ui *UI) View() string {
 	if ui.error != nil {
-		return ui.common.RenderCentered(
+		return ui.common.RenderCenteredWithLogo(
+			common.LogoSprite[0],
 			fmt.Sprintf(
-				"%s\n\n%s\n%s\n%s",
-				common.LogoSprite[0],
+				"%s\n%s\n%s",
 				common.ErrorStyle.Render("ERROR"),
-				ui.error.Error(),
+				wrap.String(wordwrap.String(ui.error.Error(), ui.common.Width), ui.common.Width),
 				"Press any key to exit",
 			),
 		)
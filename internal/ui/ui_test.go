@@ -0,0 +1,477 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8swatch "k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/ivanvc/boombox/internal/config"
+	"github.com/ivanvc/boombox/internal/identity"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+	"github.com/ivanvc/boombox/internal/services/kubernetes/fake"
+	"github.com/ivanvc/boombox/internal/ui/actions"
+	"github.com/ivanvc/boombox/internal/ui/common"
+	"github.com/ivanvc/boombox/internal/ui/common/state"
+	"github.com/ivanvc/boombox/internal/ui/uitest"
+	"github.com/ivanvc/boombox/internal/watch"
+)
+
+const (
+	testUser         = "alice"
+	testResourceName = "boombox-" + testUser
+)
+
+// How long to wait for each state change.
+const stateTimeout = 5 * time.Second
+
+// testSession is the SSH session of the user, with a PTY.
+type testSession struct {
+	ssh.Session
+}
+
+func (s *testSession) Environ() []string {
+	return []string{"LANG=C.UTF-8"}
+}
+
+func (s *testSession) Pty() (ssh.Pty, <-chan ssh.Window, bool) {
+	return ssh.Pty{Term: "xterm-256color", Window: ssh.Window{Width: 80, Height: 24}}, nil, true
+}
+
+// stateRecorder sends the state changes to msgs, before the UI handles them.
+type stateRecorder struct {
+	tea.Model
+	msgs chan<- state.StateChangedMsg
+}
+
+func (r stateRecorder) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(state.StateChangedMsg); ok {
+		r.msgs <- msg
+	}
+	var cmd tea.Cmd
+	r.Model, cmd = r.Model.Update(msg)
+	return r, cmd
+}
+
+// harness runs the UI in a Bubble Tea program, with a fake backend.
+type harness struct {
+	t       *testing.T
+	backend *fake.Backend
+	common  *common.Common
+	msgs    chan state.StateChangedMsg
+}
+
+func newHarness(t *testing.T, objects ...runtime.Object) *harness {
+	backend := fake.New(objects...)
+	backend.Exec.Shell = fake.Output("$ exit\r\n", 0)
+	return &harness{
+		t:       t,
+		backend: backend,
+		common: &common.Common{
+			Session:      &testSession{},
+			User:         testUser,
+			ResourceName: testResourceName,
+			Width:        80,
+			Height:       24,
+			Client:       backend,
+			Config: &config.Config{
+				ContainerImage: "ubuntu",
+				PVCSize:        "1Gi",
+				EnvAllowList:   []string{"LANG"},
+			},
+			Actions: actions.New(context.Background(), backend, "replica/session"),
+			Watches: watch.NewHub(),
+		},
+		msgs: make(chan state.StateChangedMsg, 100),
+	}
+}
+
+// Runs the UI, until it's stopped at the end of the test.
+func (h *harness) run() {
+	// The program needs an input to release the terminal for the shell.
+	input, inputWriter := io.Pipe()
+	p := tea.NewProgram(stateRecorder{New(h.common), h.msgs},
+		tea.WithInput(input),
+		tea.WithOutput(io.Discard),
+		tea.WithoutSignalHandler(),
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run()
+	}()
+	h.t.Cleanup(func() {
+		p.Quit()
+		inputWriter.Close()
+		<-done
+	})
+}
+
+// Waits for the UI to go through the states, and returns the last change.
+func (h *harness) expectStates(states ...state.State) state.StateChangedMsg {
+	h.t.Helper()
+	var msg state.StateChangedMsg
+	for _, want := range states {
+		select {
+		case msg = <-h.msgs:
+			if msg.State != want {
+				h.t.Fatalf("got state %d (error: %v), want %d", msg.State, msg.Error, want)
+			}
+		case <-time.After(stateTimeout):
+			h.t.Fatalf("timed out waiting for state %d", want)
+		}
+	}
+	return msg
+}
+
+func (h *harness) pod() *corev1.Pod {
+	h.t.Helper()
+	pod, err := h.backend.GetPod(h.common.ResourceName)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return pod
+}
+
+func (h *harness) pvc() *corev1.PersistentVolumeClaim {
+	h.t.Helper()
+	pvc, err := h.backend.GetPVC(h.common.ResourceName)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return pvc
+}
+
+// Returns the commands run with a TTY, i.e., the user's shells.
+func (h *harness) shells() []fake.Command {
+	var shells []fake.Command
+	for _, cmd := range h.backend.Exec.Commands() {
+		if cmd.TTY {
+			shells = append(shells, cmd)
+		}
+	}
+	return shells
+}
+
+func TestFirstLogin(t *testing.T) {
+	h := newHarness(t)
+	h.run()
+
+	h.expectStates(
+		state.FetchingPVC,
+		state.CreatingPVC,
+		state.WaitingForPVC,
+		state.CreatingPod,
+		state.WaitingForPod,
+		state.WaitingForInitContainer,
+		state.WaitingForPod,
+		state.PodRunning,
+		state.SelectingSession,
+		state.AttachedToPod,
+	)
+	msg := h.expectStates(state.PodTerminated)
+	if msg.ExitCode != 0 {
+		t.Errorf("got exit code %d, want 0", msg.ExitCode)
+	}
+
+	if pvc := h.pvc(); pvc == nil || pvc.Spec.Resources.Requests.Storage().String() != "1Gi" {
+		t.Errorf("got PVC %v, want a 1Gi PVC", pvc)
+	}
+	pod := h.pod()
+	if pod == nil {
+		t.Fatal("the Pod was not created")
+	}
+	if image := pod.Spec.InitContainers[0].Image; image != "ivan/boombox-init:ubuntu" {
+		t.Errorf("got init container image %q, want the initial one", image)
+	}
+
+	shells := h.shells()
+	if len(shells) != 1 {
+		t.Fatalf("got %d shells, want 1", len(shells))
+	}
+	if line := shells[0].Line(); !strings.Contains(line, "su - "+testUser) || !strings.Contains(line, "LANG=C.UTF-8") {
+		t.Errorf("got shell %q, want the user's login shell with the environment", line)
+	}
+	if got := h.backend.Exec.Sizes(); len(got) == 0 || got[0] != (remotecommand.TerminalSize{Width: 80, Height: 24}) {
+		t.Errorf("got terminal sizes %v, want 80x24 first", got)
+	}
+}
+
+func TestReturningUser(t *testing.T) {
+	h := newHarness(t, fake.BoundPVC(testResourceName))
+	h.run()
+
+	h.expectStates(
+		state.FetchingPVC,
+		state.CreatingPod,
+		state.WaitingForPod,
+		state.WaitingForInitContainer,
+		state.WaitingForPod,
+		state.PodRunning,
+		state.SelectingSession,
+		state.AttachedToPod,
+		state.PodTerminated,
+	)
+
+	pod := h.pod()
+	if pod == nil {
+		t.Fatal("the Pod was not created")
+	}
+	if image := pod.Spec.InitContainers[0].Image; image != "ivan/boombox-box:ubuntu" {
+		t.Errorf("got init container image %q, want the returning user's one", image)
+	}
+}
+
+func TestPodAlreadyRunning(t *testing.T) {
+	h := newHarness(t, fake.BoundPVC(testResourceName), fake.RunningPod(testResourceName, testUser))
+	h.backend.Exec.Shell = fake.Output("", 3)
+	h.run()
+
+	h.expectStates(state.PodRunning, state.SelectingSession, state.AttachedToPod)
+	msg := h.expectStates(state.PodTerminated)
+	if msg.ExitCode != 3 {
+		t.Errorf("got exit code %d, want 3", msg.ExitCode)
+	}
+	if leases, _ := h.backend.CoordinationV1().Leases(fake.Namespace).List(context.Background(), metav1.ListOptions{}); len(leases.Items) != 0 {
+		t.Errorf("got %d provisioning locks, want none", len(leases.Items))
+	}
+}
+
+func TestResumeSession(t *testing.T) {
+	h := newHarness(t, fake.BoundPVC(testResourceName), fake.RunningPod(testResourceName, testUser))
+	h.common.Config.SessionMultiplexer = true
+	h.common.Selector = identity.Selector{Kind: identity.SelectorResume}
+	h.backend.Exec.Handle("tmux list-sessions", fake.Output("work\t1700000000\t1700000100\t0\t/dev/pts/1\tvim\n", 0))
+	h.run()
+
+	msg := h.expectStates(state.PodRunning, state.SelectingSession)
+	if len(msg.Sessions) != 1 || msg.Sessions[0].ID != "work" {
+		t.Fatalf("got sessions %+v, want the work session", msg.Sessions)
+	}
+	if msg := h.expectStates(state.AttachedToPod); msg.Session != "work" {
+		t.Errorf("got session %q, want work", msg.Session)
+	}
+	h.expectStates(state.PodTerminated)
+
+	shells := h.shells()
+	if len(shells) != 1 || !strings.Contains(shells[0].Line(), "tmux attach-session -t '=work'") {
+		t.Errorf("got shells %v, want to attach to the work session", shells)
+	}
+}
+
+func TestErrorCreatingPod(t *testing.T) {
+	h := newHarness(t, fake.BoundPVC(testResourceName))
+	h.backend.Clientset.PrependReactor("create", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("exceeded quota")
+	})
+	h.run()
+
+	msg := h.expectStates(state.FetchingPVC, state.CreatingPod, state.Error)
+	if msg.Error == nil || !strings.Contains(msg.Error.Error(), "exceeded quota") {
+		t.Errorf("got error %v, want the quota error", msg.Error)
+	}
+	if pod := h.pod(); pod != nil {
+		t.Errorf("got Pod %s, want none", pod.Name)
+	}
+	if len(h.backend.Exec.Commands()) != 0 {
+		t.Errorf("got commands %v, want none", h.backend.Exec.Commands())
+	}
+}
+
+func TestInvalidPVCSize(t *testing.T) {
+	h := newHarness(t)
+	h.common.Account = &k8s.BoomboxUser{Spec: k8s.BoomboxUserSpec{PVCSize: "10 gigs"}}
+	h.run()
+
+	msg := h.expectStates(state.FetchingPVC, state.CreatingPVC, state.Error)
+	if msg.Error == nil || !strings.Contains(msg.Error.Error(), `invalid PVC size "10 gigs"`) {
+		t.Errorf("got error %v, want the invalid size error", msg.Error)
+	}
+	if pvc := h.pvc(); pvc != nil {
+		t.Errorf("got PVC %s, want none", pvc.Name)
+	}
+}
+
+func TestPodStartupFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		fail   func(*corev1.Pod)
+		states []state.State
+		want   string
+	}{
+		{
+			name: "image pull",
+			fail: func(pod *corev1.Pod) {
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+					Name:  "ubuntu",
+					Image: "ubuntu:nope",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+						Reason:  "ImagePullBackOff",
+						Message: `Back-off pulling image "ubuntu:nope"`,
+					}},
+				}}
+			},
+			want: `can't pull the image "ubuntu:nope": Back-off pulling image "ubuntu:nope"`,
+		},
+		{
+			name: "crash loop",
+			fail: func(pod *corev1.Pod) {
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+					Name:                 "ubuntu",
+					State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 127}},
+				}}
+			},
+			want: `the container "ubuntu" keeps crashing, it exited with status 127`,
+		},
+		{
+			name: "unschedulable",
+			fail: func(pod *corev1.Pod) {
+				pod.Status.Conditions = []corev1.PodCondition{{
+					Type:    corev1.PodScheduled,
+					Status:  corev1.ConditionFalse,
+					Reason:  corev1.PodReasonUnschedulable,
+					Message: "0/3 nodes are available: 3 Insufficient memory.",
+				}}
+			},
+			want: "the box can't be scheduled: 0/3 nodes are available: 3 Insufficient memory.",
+		},
+		{
+			name: "init container",
+			fail: func(pod *corev1.Pod) {
+				if len(pod.Status.InitContainerStatuses) == 0 {
+					fake.StartPod(pod)
+					return
+				}
+				pod.Status.Phase = corev1.PodFailed
+				pod.Status.InitContainerStatuses[0].State = corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 2},
+				}
+			},
+			states: []state.State{state.WaitingForInitContainer, state.WaitingForPod},
+			want:   `the container "init" failed setting up the box, it exited with status 2`,
+		},
+		{
+			name: "evicted",
+			fail: func(pod *corev1.Pod) {
+				pod.Status.Phase = corev1.PodFailed
+				pod.Status.Reason = "Evicted"
+				pod.Status.Message = "The node was low on resource: memory."
+			},
+			want: "the box failed: The node was low on resource: memory.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t, fake.BoundPVC(testResourceName))
+			h.common.Config.DeleteFailedPods = true
+			h.backend.StartPod = tt.fail
+			h.run()
+
+			h.expectStates(state.FetchingPVC, state.CreatingPod, state.WaitingForPod)
+			h.expectStates(tt.states...)
+			msg := h.expectStates(state.Error)
+			if msg.Error == nil || msg.Error.Error() != tt.want {
+				t.Errorf("got error %v, want %q", msg.Error, tt.want)
+			}
+			deadline := time.Now().Add(stateTimeout)
+			for h.pod() != nil {
+				if time.Now().After(deadline) {
+					t.Fatal("the Pod that failed to start was not deleted")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestPodStartupFailureKeepsPod(t *testing.T) {
+	h := newHarness(t, fake.BoundPVC(testResourceName))
+	h.backend.StartPod = func(pod *corev1.Pod) {
+		pod.Status.Phase = corev1.PodFailed
+	}
+	h.run()
+
+	msg := h.expectStates(state.FetchingPVC, state.CreatingPod, state.WaitingForPod, state.Error)
+	var startupErr *k8s.PodStartupError
+	if !errors.As(msg.Error, &startupErr) || startupErr.Reason != "Failed" {
+		t.Fatalf("got error %v, want a startup error", msg.Error)
+	}
+	// The UI deletes failed Pods in the background, give it a chance.
+	time.Sleep(100 * time.Millisecond)
+	if h.pod() == nil {
+		t.Error("the Pod was deleted, want it kept")
+	}
+}
+
+func TestPodAlreadyFailed(t *testing.T) {
+	pod := fake.RunningPod(testResourceName, testUser)
+	pod.Status.Phase = corev1.PodFailed
+	pod.Status.Reason = "Evicted"
+	pod.Status.Message = "The node was low on resource: memory."
+	h := newHarness(t, fake.BoundPVC(testResourceName), pod)
+	// The watch doesn't change the Pod, so it has to be checked before.
+	h.backend.StartPod = func(*corev1.Pod) {}
+	h.run()
+
+	msg := h.expectStates(state.WaitingForPod, state.Error)
+	var startupErr *k8s.PodStartupError
+	if !errors.As(msg.Error, &startupErr) || startupErr.Reason != "Evicted" {
+		t.Fatalf("got error %v, want a startup error", msg.Error)
+	}
+	if want := "the box failed: The node was low on resource: memory."; msg.Error.Error() != want {
+		t.Errorf("got error %q, want %q", msg.Error, want)
+	}
+}
+
+func TestPodWatchExpired(t *testing.T) {
+	pod := fake.RunningPod(testResourceName, testUser)
+	pod.Status.Phase = corev1.PodPending
+	h := newHarness(t, fake.BoundPVC(testResourceName), pod)
+	// The first watch fails, as the Pod's version was compacted.
+	var watches int32
+	h.backend.Clientset.PrependWatchReactor("pods", func(k8stesting.Action) (bool, k8swatch.Interface, error) {
+		if atomic.AddInt32(&watches, 1) > 1 {
+			return false, nil, nil
+		}
+		w := k8swatch.NewFakeWithChanSize(1, false)
+		w.Error(&apierrors.NewResourceExpired("too old resource version").ErrStatus)
+		return true, w, nil
+	})
+	h.run()
+
+	h.expectStates(state.WaitingForPod, state.PodRunning)
+	if n := atomic.LoadInt32(&watches); n != 2 {
+		t.Errorf("got %d watches, want 2", n)
+	}
+}
+
+func TestErrorView(t *testing.T) {
+	for _, size := range []struct{ width, height int }{{80, 24}, {120, 40}, {40, 10}} {
+		name := fmt.Sprintf("error_%dx%d", size.width, size.height)
+		t.Run(name, func(t *testing.T) {
+			ui := New(newHarness(t).common)
+			ui.Init()
+			h := uitest.New(t, ui, size.width, size.height)
+			h.Send(state.StateChangedMsg{
+				State: state.Error,
+				Error: errors.New(`pods "boombox-alice" is forbidden: exceeded quota`),
+			})
+			h.AssertGolden(name)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Package uitest tests Bubble Tea models, comparing their screens with golden
+// files. Run the tests with -update to write the golden files.
+package uitest
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
+	"github.com/muesli/termenv"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+var escapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+
+// Harness sends messages to a model, without running the commands it
+// returns, so the timers, spinners, and sprites only change with the
+// messages sent by the test.
+type Harness struct {
+	t      testing.TB
+	model  tea.Model
+	width  int
+	height int
+}
+
+// New returns a Harness for the model, in a terminal of the size.
+func New(t testing.TB, model tea.Model, width, height int) *Harness {
+	lipgloss.SetColorProfile(termenv.Ascii)
+	h := &Harness{t: t, model: model}
+	h.Resize(width, height)
+	return h
+}
+
+// Model returns the model, as updated by the messages.
+func (h *Harness) Model() tea.Model {
+	return h.model
+}
+
+// Send sends the messages to the model, in order.
+func (h *Harness) Send(msgs ...tea.Msg) {
+	for _, msg := range msgs {
+		h.model, _ = h.model.Update(msg)
+	}
+}
+
+// Resize resizes the terminal.
+func (h *Harness) Resize(width, height int) {
+	h.width, h.height = width, height
+	h.Send(tea.WindowSizeMsg{Width: width, Height: height})
+}
+
+// Screen returns the view as the terminal shows it: as Bubble Tea does, the
+// lines are cut to the width, and only the last lines that fit are shown.
+func (h *Harness) Screen() string {
+	lines := strings.Split(h.model.View(), "\n")
+	if len(lines) > h.height {
+		lines = lines[len(lines)-h.height:]
+	}
+	for i, line := range lines {
+		line = truncate.String(line, uint(h.width))
+		lines[i] = strings.TrimRight(escapeSequence.ReplaceAllString(line, ""), " ")
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// AssertGolden compares the screen with the golden file
+// testdata/<name>.golden.
+func (h *Harness) AssertGolden(name string) {
+	h.t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	got := h.Screen()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			h.t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			h.t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		h.t.Fatalf("%v, run the test with -update to write it", err)
+	}
+	if got != string(want) {
+		h.t.Errorf("the screen doesn't match %s\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
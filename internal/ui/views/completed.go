@@ -14,8 +14,9 @@ const timeout = time.Second * 5
 
 // The Completed view holds the last screen after the pod has been terminated.
 type Completed struct {
-	timer  timer.Model
-	common *common.Common
+	timer    timer.Model
+	common   *common.Common
+	exitCode int
 }
 
 // NewCompleted returns a new Completed instance.
@@ -33,6 +34,7 @@ func (c *Completed) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case state.StateChangedMsg:
 		if msg.State == state.PodTerminated {
+			c.exitCode = msg.ExitCode
 			c.timer = timer.NewWithInterval(timeout, time.Second)
 			return c, c.timer.Init()
 		}
@@ -59,9 +61,15 @@ func (c *Completed) View() string {
 		timerView = "Exiting in " + c.timer.View()
 	}
 
-	return c.common.RenderCentered(
+	exitView := "Shell exited"
+	if c.exitCode != 0 {
+		exitView = common.ErrorStyle.Render(fmt.Sprintf("Shell exited with status %d", c.exitCode))
+	}
+
+	return c.common.RenderCenteredWithLogo(
+		common.LogoSprite[0],
 		fmt.Sprintf("%s\n\n%s\n%s\n",
-			common.LogoSprite[0],
+			exitView,
 			timerView,
 			"Press any key to exit",
 		),
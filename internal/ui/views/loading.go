@@ -39,7 +39,7 @@ func NewLoading(cmn *common.Common) *Loading {
 		durations: make([]time.Duration, statesLen),
 		common:    cmn,
 		spriteSub: make(spriteSub),
-		startTime: time.Now(),
+		startTime: now(),
 		spinner:   s,
 	}
 }
@@ -57,8 +57,8 @@ func (l *Loading) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		l.spriteIndex = (l.spriteIndex + 1) % uint8(len(common.LogoSprite))
 		return l, waitForSpriteChanges(l.spriteSub)
 	case state.StateChangedMsg:
-		l.durations[len(l.durations)-1] = time.Now().Sub(l.startTime).Round(time.Millisecond)
-		l.startTime = time.Now()
+		l.durations[len(l.durations)-1] = now().Sub(l.startTime).Round(time.Millisecond)
+		l.startTime = now()
 		l.states = append(l.states[1:], msg.State)
 		l.durations = append(l.durations[1:], 0)
 	case spinner.TickMsg:
@@ -72,14 +72,21 @@ func (l *Loading) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 // View implements tea.Model.
 func (l *Loading) View() string {
-	return l.common.RenderCentered(
+	var banner string
+	if l.common.Recording() {
+		banner = "\n" + common.RecordingStyle.Render("● This session will be recorded") + "\n"
+	}
+	// The box is narrower in small terminals, and the states wrap.
+	width := 50
+	if l.common.Width < width+2 {
+		width = l.common.Width - 2
+	}
+	return l.common.RenderCenteredWithLogo(
+		common.LogoSprite[l.spriteIndex],
 		fmt.Sprintf(
-			"%s\n\n%s\n",
-			common.LogoSprite[l.spriteIndex],
-			common.BoxContainerStyle.Width(50).Render(
-				l.renderStates(),
-				//lipgloss.PlaceHorizontal(50, lipgloss.Left, l.renderStates()),
-			),
+			"%s\n%s",
+			common.BoxContainerStyle.Width(width).Render(l.renderStates()),
+			banner,
 		),
 	)
 }
@@ -92,7 +99,7 @@ func (l *Loading) renderStates() string {
 		if i == len(l.states)-1 {
 			indicator = l.spinner.View()
 			text = l.states[i].String()
-			duration = time.Now().Sub(l.startTime).Round(time.Millisecond).String()
+			duration = now().Sub(l.startTime).Round(time.Millisecond).String()
 		} else if l.states[i] > state.Unknown {
 			indicator = common.CheckMark.Render()
 			text = l.states[i].String()
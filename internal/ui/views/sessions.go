@@ -0,0 +1,139 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	corev1 "k8s.io/api/core/v1"
+
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+	"github.com/ivanvc/boombox/internal/ui/actions"
+	"github.com/ivanvc/boombox/internal/ui/common"
+	"github.com/ivanvc/boombox/internal/ui/common/state"
+)
+
+// The Sessions view lists the user's sessions in the running Pod, and lets
+// the user open a new shell, join a session, or kill one.
+type Sessions struct {
+	common   *common.Common
+	pod      *corev1.Pod
+	sessions []k8s.Session
+	cursor   int
+}
+
+// NewSessions returns a new Sessions instance.
+func NewSessions(common *common.Common) *Sessions {
+	return &Sessions{common: common}
+}
+
+// Init implements tea.Model.
+func (s *Sessions) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model.
+func (s *Sessions) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case state.StateChangedMsg:
+		if msg.State == state.SelectingSession {
+			s.pod = msg.Pod
+			s.sessions = msg.Sessions
+			if s.cursor >= len(s.sessions) {
+				s.cursor = len(s.sessions) - 1
+			}
+			if s.cursor < 0 {
+				s.cursor = 0
+			}
+		}
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			if s.cursor > 0 {
+				s.cursor--
+			}
+		case "down", "j":
+			if s.cursor < len(s.sessions)-1 {
+				s.cursor++
+			}
+		case "n":
+			return s, actions.Attach(s.pod, "", false)
+		case "enter":
+			if session := s.selected(); session != nil && session.Multiplexed {
+				return s, actions.Attach(s.pod, session.ID, false)
+			}
+		case "r":
+			if session := s.selected(); session != nil && session.Multiplexed {
+				return s, actions.Attach(s.pod, session.ID, true)
+			}
+		case "x":
+			if session := s.selected(); session != nil {
+				return s, s.common.Actions.KillSession(s.pod, s.common.User, *session, s.common.Config.SessionMultiplexer)
+			}
+		case "q", "esc":
+			return s, tea.Quit
+		}
+	}
+
+	return s, nil
+}
+
+// Returns the session under the cursor, or nil if there are no sessions.
+func (s *Sessions) selected() *k8s.Session {
+	if len(s.sessions) == 0 {
+		return nil
+	}
+	return &s.sessions[s.cursor]
+}
+
+// View implements tea.Model.
+func (s *Sessions) View() string {
+	var b strings.Builder
+	for i, session := range s.sessions {
+		line := fmt.Sprintf("%-8s %-8s started %s ago, idle %s  %s",
+			session.ID,
+			session.TTY,
+			since(session.Started),
+			since(session.Activity),
+			session.Command,
+		)
+		if session.Attached > 0 {
+			line += " (attached)"
+		}
+		if i == s.cursor {
+			line = "> " + line
+		} else {
+			line = common.SecondaryTextStyle.Render("  " + line)
+		}
+		b.WriteString(line + "\n")
+	}
+	if len(s.sessions) == 0 {
+		b.WriteString(common.SecondaryTextStyle.Render("There are no sessions") + "\n")
+	}
+
+	help := "n new shell, x kill, q exit"
+	if s.common.Config.SessionMultiplexer {
+		help = "enter join, r join read-only, " + help
+	} else if len(s.sessions) > 0 {
+		b.WriteString("\n" + common.SecondaryTextStyle.Render("Joining a session needs session-multiplexer enabled in Boombox") + "\n")
+	}
+
+	return s.common.RenderCenteredWithLogo(
+		common.LogoSprite[0],
+		fmt.Sprintf("%s\n\n%s\n%s\n",
+			"You have running sessions",
+			b.String(),
+			common.SecondaryTextStyle.Render("↑/↓ move, "+help),
+		),
+	)
+}
+
+// Returns the time since t, rounded for display.
+func since(t time.Time) string {
+	d := time.Since(t)
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return d.Round(time.Minute).String()
+}
@@ -72,8 +72,14 @@ func (t *Tail) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return -1
 		}, string(msg))
 		t.logLines = append(t.logLines, cleanLine)
-		if len(t.logLines) > t.viewport.Height {
-			t.logLines = t.logLines[len(t.logLines)-t.viewport.Height:]
+		// Keep the lines that fit in the box, without its border, so the
+		// last ones are visible.
+		height := t.viewport.Height - t.viewport.Style.GetVerticalFrameSize()
+		if height < 0 {
+			height = 0
+		}
+		if len(t.logLines) > height {
+			t.logLines = t.logLines[len(t.logLines)-height:]
 		}
 		return t, waitForLines(t.logLinesChan)
 	case actions.TriggerStartLogTailMsg:
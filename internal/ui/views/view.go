@@ -1,6 +1,10 @@
 package views
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
 
 // View is the interface of an UI view.
 type View interface {
@@ -8,3 +12,6 @@ type View interface {
 	Update(tea.Msg) (tea.Model, tea.Cmd)
 	View() string
 }
+
+// now returns the current time. The tests replace it with a fixed clock.
+var now = time.Now
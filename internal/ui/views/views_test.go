@@ -0,0 +1,164 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/timer"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/ivanvc/boombox/internal/config"
+	"github.com/ivanvc/boombox/internal/recording"
+	k8s "github.com/ivanvc/boombox/internal/services/kubernetes"
+	"github.com/ivanvc/boombox/internal/ui/common"
+	"github.com/ivanvc/boombox/internal/ui/common/state"
+	"github.com/ivanvc/boombox/internal/ui/uitest"
+)
+
+// The terminal sizes to render the views in.
+var sizes = []struct{ width, height int }{
+	{80, 24},
+	{120, 40},
+	{40, 10},
+}
+
+// clock is a fixed clock, that only moves when the test advances it.
+type clock struct {
+	t time.Time
+}
+
+func useClock(t *testing.T) *clock {
+	c := &clock{t: time.Date(2023, time.June, 1, 12, 0, 0, 0, time.UTC)}
+	now = func() time.Time { return c.t }
+	t.Cleanup(func() { now = time.Now })
+	return c
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// sized sets the terminal size in Common, as the UI does, before passing the
+// messages to the view.
+type sized struct {
+	tea.Model
+	common *common.Common
+}
+
+func (s sized) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.WindowSizeMsg); ok {
+		s.common.Width, s.common.Height = msg.Width, msg.Height
+	}
+	var cmd tea.Cmd
+	s.Model, cmd = s.Model.Update(msg)
+	return s, cmd
+}
+
+func newCommon(cfg *config.Config) *common.Common {
+	return &common.Common{User: "alice", Config: cfg, State: state.FetchingPod}
+}
+
+func TestLoadingView(t *testing.T) {
+	for _, size := range sizes {
+		t.Run(fmt.Sprintf("%dx%d", size.width, size.height), func(t *testing.T) {
+			clock := useClock(t)
+			cmn := newCommon(&config.Config{})
+			h := uitest.New(t, sized{NewLoading(cmn), cmn}, size.width, size.height)
+
+			clock.advance(120 * time.Millisecond)
+			h.Send(state.StateChangedMsg{State: state.FetchingPVC})
+			clock.advance(80 * time.Millisecond)
+			h.Send(state.StateChangedMsg{State: state.CreatingPod})
+			clock.advance(1500 * time.Millisecond)
+			h.Send(state.StateChangedMsg{State: state.WaitingForPod})
+			clock.advance(350 * time.Millisecond)
+			h.AssertGolden(fmt.Sprintf("loading_%dx%d", size.width, size.height))
+
+			// The logo animates.
+			h.Send(spriteIndexChangeMsg{}, spriteIndexChangeMsg{})
+			h.AssertGolden(fmt.Sprintf("loading_sprite_%dx%d", size.width, size.height))
+		})
+	}
+}
+
+func TestLoadingViewRecording(t *testing.T) {
+	useClock(t)
+	cmn := newCommon(&config.Config{Recording: recording.ModeEnforced})
+	h := uitest.New(t, sized{NewLoading(cmn), cmn}, 80, 24)
+	h.AssertGolden("loading_recording_80x24")
+}
+
+func TestTailView(t *testing.T) {
+	for _, size := range sizes {
+		t.Run(fmt.Sprintf("%dx%d", size.width, size.height), func(t *testing.T) {
+			cmn := newCommon(&config.Config{})
+			h := uitest.New(t, sized{NewTail(cmn), cmn}, size.width, size.height)
+			h.AssertGolden(fmt.Sprintf("tail_empty_%dx%d", size.width, size.height))
+
+			h.Send(
+				logLineMsg("Setting up the home directory"),
+				logLineMsg("Copying \x1b[1m/etc/skel\x1b[0m"),
+				logLineMsg("Installing packages:\tgit vim tmux"),
+			)
+			h.AssertGolden(fmt.Sprintf("tail_lines_%dx%d", size.width, size.height))
+
+			for i := 1; i <= 20; i++ {
+				h.Send(logLineMsg(fmt.Sprintf("Unpacking package %d of 20", i)))
+			}
+			h.AssertGolden(fmt.Sprintf("tail_scrolled_%dx%d", size.width, size.height))
+		})
+	}
+}
+
+func TestCompletedView(t *testing.T) {
+	tests := []struct {
+		name     string
+		exitCode int
+		ticks    int
+	}{
+		{"completed", 0, 0},
+		{"completed_status", 2, 1},
+		{"completed_timeout", 0, 5},
+	}
+	for _, tt := range tests {
+		for _, size := range sizes {
+			name := fmt.Sprintf("%s_%dx%d", tt.name, size.width, size.height)
+			t.Run(name, func(t *testing.T) {
+				cmn := newCommon(&config.Config{})
+				h := uitest.New(t, sized{NewCompleted(cmn), cmn}, size.width, size.height)
+				h.Send(state.StateChangedMsg{State: state.PodTerminated, ExitCode: tt.exitCode})
+				for i := 0; i < tt.ticks; i++ {
+					h.Send(timer.TickMsg{})
+				}
+				h.AssertGolden(name)
+			})
+		}
+	}
+}
+
+func TestSessionsViewHelp(t *testing.T) {
+	sessions := []k8s.Session{{ID: "pts/0", TTY: "pts/0", Command: "bash", Started: time.Now(), Activity: time.Now()}}
+	tests := []struct {
+		name        string
+		multiplexer bool
+		want        string
+		notWant     string
+	}{
+		{"with the multiplexer", true, "enter join, r join read-only", "needs session-multiplexer"},
+		{"without the multiplexer", false, "Joining a session needs session-multiplexer", "enter join"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmn := newCommon(&config.Config{SessionMultiplexer: tt.multiplexer})
+			cmn.Width, cmn.Height = 120, 40
+			view := NewSessions(cmn)
+			view.Update(state.StateChangedMsg{State: state.SelectingSession, Sessions: sessions})
+			got := view.View()
+			if !strings.Contains(got, tt.want) || strings.Contains(got, tt.notWant) {
+				t.Errorf("got view:\n%s\nwant %q, without %q", got, tt.want, tt.notWant)
+			}
+		})
+	}
+}
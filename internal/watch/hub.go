@@ -0,0 +1,190 @@
+// Package watch mirrors the output of the interactive sessions to watchers.
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// The number of output chunks buffered for a watcher, before it's dropped
+// for being too slow.
+const viewerBufferSize = 256
+
+// ErrNoSession is returned when the user has no session to watch.
+var ErrNoSession = errors.New("the user has no active session")
+
+// NotifyFunc shows a message to the watched user. It's called from a new
+// goroutine, so a slow client doesn't block the session output.
+type NotifyFunc func(msg string)
+
+// RedrawFunc asks the watched session to redraw its screen, which has the
+// terminal size, so a new watcher sees all of it. It's called from a new
+// goroutine.
+type RedrawFunc func(width, height int)
+
+// Hub holds the sessions that can be watched, by user.
+type Hub struct {
+	mu      sync.Mutex
+	streams map[string][]*Stream
+}
+
+// NewHub returns a new *Hub.
+func NewHub() *Hub {
+	return &Hub{streams: make(map[string][]*Stream)}
+}
+
+// Publish makes a session of the user watchable, with the initial terminal
+// size. The watched user is notified with notify when watchers join or leave,
+// and the session is redrawn with redraw when a watcher joins. The session is
+// removed from the Hub when the Stream is closed.
+func (h *Hub) Publish(user string, width, height int, notify NotifyFunc, redraw RedrawFunc) *Stream {
+	s := &Stream{
+		hub:     h,
+		user:    user,
+		width:   width,
+		height:  height,
+		notify:  notify,
+		redraw:  redraw,
+		viewers: make(map[*Viewer]bool),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.streams[user] = append(h.streams[user], s)
+	return s
+}
+
+// Watch returns a new Viewer of the user's most recent session, for the
+// watcher.
+func (h *Hub) Watch(user, watcher string) (*Viewer, error) {
+	h.mu.Lock()
+	streams := h.streams[user]
+	h.mu.Unlock()
+	if len(streams) == 0 {
+		return nil, ErrNoSession
+	}
+	return streams[len(streams)-1].join(watcher), nil
+}
+
+func (h *Hub) remove(s *Stream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	streams := h.streams[s.user]
+	for i, stream := range streams {
+		if stream == s {
+			streams = append(streams[:i], streams[i+1:]...)
+			break
+		}
+	}
+	if len(streams) == 0 {
+		delete(h.streams, s.user)
+	} else {
+		h.streams[s.user] = streams
+	}
+}
+
+// Stream is a watchable session. It implements the kubernetes.Recorder
+// interface, so it gets the output of the session's attachment.
+type Stream struct {
+	hub    *Hub
+	user   string
+	notify NotifyFunc
+	redraw RedrawFunc
+
+	mu      sync.Mutex
+	width   int
+	height  int
+	viewers map[*Viewer]bool
+	closed  bool
+}
+
+// Input implements kubernetes.Recorder. The input is not mirrored.
+func (s *Stream) Input(p []byte) {}
+
+// Output implements kubernetes.Recorder. It sends a copy of p to the viewers,
+// and drops the ones that can't keep up.
+func (s *Stream) Output(p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.viewers) == 0 {
+		return
+	}
+	data := append([]byte(nil), p...)
+	for v := range s.viewers {
+		select {
+		case v.output <- data:
+		default:
+			s.leave(v, "was disconnected from")
+		}
+	}
+}
+
+// Resize implements kubernetes.Recorder.
+func (s *Stream) Resize(width, height uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.width, s.height = int(width), int(height)
+}
+
+// Close implements kubernetes.Recorder. It ends the viewers, and removes the
+// session from the Hub.
+func (s *Stream) Close() error {
+	s.hub.remove(s)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for v := range s.viewers {
+		delete(s.viewers, v)
+		close(v.output)
+	}
+	return nil
+}
+
+func (s *Stream) join(watcher string) *Viewer {
+	v := &Viewer{stream: s, watcher: watcher, output: make(chan []byte, viewerBufferSize)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v.Width, v.Height = s.width, s.height
+	if s.closed {
+		close(v.output)
+		return v
+	}
+	s.viewers[v] = true
+	go s.notify(fmt.Sprintf("%s started watching your session", watcher))
+	go s.redraw(s.width, s.height)
+	return v
+}
+
+// Removes the viewer, it must be called with the lock held.
+func (s *Stream) leave(v *Viewer, action string) {
+	if !s.viewers[v] {
+		return
+	}
+	delete(s.viewers, v)
+	close(v.output)
+	go s.notify(fmt.Sprintf("%s %s your session", v.watcher, action))
+}
+
+// Viewer is a watcher of a Stream.
+type Viewer struct {
+	// Width and Height of the watched terminal when the viewer joined.
+	Width  int
+	Height int
+
+	stream  *Stream
+	watcher string
+	output  chan []byte
+}
+
+// Output returns the channel with the session output. It's closed when the
+// session ends, or when the viewer can't keep up.
+func (v *Viewer) Output() <-chan []byte {
+	return v.output
+}
+
+// Close stops watching the session.
+func (v *Viewer) Close() {
+	v.stream.mu.Lock()
+	defer v.stream.mu.Unlock()
+	v.stream.leave(v, "stopped watching")
+}